@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"nn/network"
 	"nn/network/exptree"
+	"os"
 )
 
 var (
@@ -29,7 +30,10 @@ func main() {
 
 	fmt.Println("train: x", trainX, " y ", trainY)
 	mlp := network.NewMultiLayerPerceptron("is_odd", 3, []int{4, 4, 1})
-	mlp.Train(1000, 0.1, trainX, trainY)
+	if _, err := mlp.Train(1000, 0.1, trainX, trainY, network.WithCallbacks(network.NewLogger(os.Stdout, 100))); err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	d := mlp.ToJSONMap()
 
@@ -0,0 +1,88 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+	"sort"
+)
+
+// Names of the activations available out of the box
+const (
+	ActivationTanh      = "tanh"
+	ActivationSigmoid   = "sigmoid"
+	ActivationReLU      = "relu"
+	ActivationLeakyReLU = "leaky_relu"
+	ActivationELU       = "elu"
+	ActivationGELU      = "gelu"
+	ActivationSoftplus  = "softplus"
+	ActivationLinear    = "linear"
+	ActivationSwish     = "swish"
+)
+
+// Activation is a named function applied to the biased output of a neuron.
+// Basically the neuron asking itself `should I trigger?`
+type Activation struct {
+	Name  string
+	Apply func(label string, in *exptree.Node) (out *exptree.Node)
+
+	// Elementwise is the function behind the activation, set for activations registered with RegisterElementwiseActivation.
+	// Only those can be applied to tensors.
+	Elementwise *exptree.Elementwise
+}
+
+var activations = map[string]*Activation{}
+
+func init() {
+	RegisterElementwiseActivation(ActivationTanh, exptree.TanhFunc)
+	RegisterElementwiseActivation(ActivationSigmoid, exptree.SigmoidFunc)
+	RegisterElementwiseActivation(ActivationReLU, exptree.ReLUFunc)
+	RegisterElementwiseActivation(ActivationLeakyReLU, exptree.LeakyReLUFunc(0.01))
+	RegisterElementwiseActivation(ActivationELU, exptree.ELUFunc(1.0))
+	RegisterElementwiseActivation(ActivationGELU, exptree.GELUFunc)
+	RegisterElementwiseActivation(ActivationSoftplus, exptree.SoftplusFunc)
+	RegisterElementwiseActivation(ActivationLinear, exptree.IdentityFunc)
+	RegisterElementwiseActivation(ActivationSwish, exptree.SwishFunc)
+}
+
+// RegisterActivation adds an activation to the registry under `name`, replacing any existing one.
+// `apply` must build its output with exptree operations so gradients flow through it.
+func RegisterActivation(name string, apply func(label string, in *exptree.Node) *exptree.Node) *Activation {
+	activation := &Activation{Name: name, Apply: apply}
+	activations[name] = activation
+	return activation
+}
+
+// RegisterElementwiseActivation adds an activation applying `fn` to each value under `name`, replacing any existing one.
+// Unlike those registered with RegisterActivation, it can also be applied to tensors.
+func RegisterElementwiseActivation(name string, fn exptree.Elementwise) *Activation {
+	activation := &Activation{Name: name, Apply: fn.Node, Elementwise: &fn}
+	activations[name] = activation
+	return activation
+}
+
+// GetActivation looks up a registered activation by `name`
+func GetActivation(name string) (*Activation, error) {
+	activation, ok := activations[name]
+	if !ok {
+		return nil, fmt.Errorf("activation: unknown activation `%s`, want one of %v", name, Activations())
+	}
+	return activation, nil
+}
+
+// Activations returns the sorted names of all registered activations
+func Activations() []string {
+	names := []string{}
+	for name := range activations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustGetActivation(name string) *Activation {
+	activation, err := GetActivation(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return activation
+}
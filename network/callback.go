@@ -0,0 +1,117 @@
+package network
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// TrainingState is what callbacks get to see of the training in progress.
+// Setting `Stop` ends the training after the current batch, or before the first batch of the epoch from OnEpochStart.
+type TrainingState struct {
+	Epoch          int
+	Batch          int // index of the batch within the epoch
+	Batches        int // number of batches in the epoch
+	LearningRate   float64
+	BatchLoss      float64 // loss of the last batch
+	Loss           float64 // loss of the epoch, set once the epoch ends
+	ValidationLoss float64 // loss over the validation set, set once the epoch ends. NaN without a validation set
+	GradientNorm   float64 // global L2 norm of the gradients of the last batch, before clipping
+	Stop           bool
+}
+
+// Callback is notified as the training progresses
+type Callback interface {
+	OnEpochStart(state *TrainingState)
+	OnBatchEnd(state *TrainingState)
+	OnEpochEnd(state *TrainingState)
+}
+
+// CallbackFuncs implements Callback from functions, any of which may be nil
+type CallbackFuncs struct {
+	EpochStart func(state *TrainingState)
+	BatchEnd   func(state *TrainingState)
+	EpochEnd   func(state *TrainingState)
+}
+
+func (c CallbackFuncs) OnEpochStart(state *TrainingState) {
+	if c.EpochStart != nil {
+		c.EpochStart(state)
+	}
+}
+
+func (c CallbackFuncs) OnBatchEnd(state *TrainingState) {
+	if c.BatchEnd != nil {
+		c.BatchEnd(state)
+	}
+}
+
+func (c CallbackFuncs) OnEpochEnd(state *TrainingState) {
+	if c.EpochEnd != nil {
+		c.EpochEnd(state)
+	}
+}
+
+// NewLogger returns a callback writing the loss and learning rate to `w` every `every` epochs
+func NewLogger(w io.Writer, every int) Callback {
+	if every <= 0 {
+		every = 1
+	}
+	return CallbackFuncs{EpochEnd: func(state *TrainingState) {
+		if state.Epoch%every != 0 {
+			return
+		}
+		if math.IsNaN(state.ValidationLoss) {
+			fmt.Fprintf(w, "[Epoch %d | Loss `%.6f` | Learning Rate `%g` | Gradient Norm `%.6f`]\n", state.Epoch, state.Loss, state.LearningRate, state.GradientNorm)
+		} else {
+			fmt.Fprintf(w, "[Epoch %d | Loss `%.6f` | Validation Loss `%.6f` | Learning Rate `%g` | Gradient Norm `%.6f`]\n", state.Epoch, state.Loss, state.ValidationLoss, state.LearningRate, state.GradientNorm)
+		}
+	}}
+}
+
+// EpochRecord is the summary of a single epoch of training
+type EpochRecord struct {
+	Epoch          int
+	Loss           float64
+	ValidationLoss float64 // NaN without a validation set
+	LearningRate   float64
+	GradientNorm   float64 // mean over the batches of the epoch
+	Duration       time.Duration
+	Partial        bool // the training stopped before all batches of the epoch ran, the losses cover only those that did
+}
+
+// TrainingHistory is the record of every epoch run by Train, an epoch stopped before its first batch not being recorded
+type TrainingHistory struct {
+	Epochs       []EpochRecord
+	Duration     time.Duration
+	Stopped      bool // the training ended before all cycles ran
+	EarlyStopped bool // the training was ended by early stopping
+	BestEpoch    int  // epoch with the lowest monitored loss when early stopping is set, -1 otherwise
+}
+
+// Losses returns the loss of each epoch
+func (h *TrainingHistory) Losses() []float64 {
+	losses := []float64{}
+	for _, e := range h.Epochs {
+		losses = append(losses, e.Loss)
+	}
+	return losses
+}
+
+// ValidationLosses returns the validation loss of each epoch
+func (h *TrainingHistory) ValidationLosses() []float64 {
+	losses := []float64{}
+	for _, e := range h.Epochs {
+		losses = append(losses, e.ValidationLoss)
+	}
+	return losses
+}
+
+// Last returns the record of the last epoch run, zero valued if none did
+func (h *TrainingHistory) Last() EpochRecord {
+	if len(h.Epochs) == 0 {
+		return EpochRecord{}
+	}
+	return h.Epochs[len(h.Epochs)-1]
+}
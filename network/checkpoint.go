@@ -0,0 +1,419 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckpointVersion is the version of the binary format written by SaveCheckpoint
+const CheckpointVersion = 3
+
+var checkpointMagic = [4]byte{'M', 'G', 'C', 'K'}
+
+// maxOptimizerSlots is the most buffers any optimizer keeps per parameter, the two moments of Adam
+const maxOptimizerSlots = 2
+
+// maxSchedulerState is the most values the state of a scheduler can hold in a checkpoint
+const maxSchedulerState = 64
+
+// ErrInvalidCheckpoint is wrapped by the errors returned when a checkpoint is corrupt or does not match the model
+var ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+
+// Checkpoint is the state needed to resume training exactly where it stopped, see WithResume.
+// `Optimizer`, `Scheduler`, `EarlyStopping` and `RNG` are optional, a nil one is neither saved nor restored.
+// The running averages of the model, e.g. of its batch normalizations, and the sources of its dropouts drawing from a Source
+// are saved along with its parameters.
+// With WithWorkers the copies of the dropouts are reseeded when the training resumes, so their masks differ from
+// those of an uninterrupted run.
+type Checkpoint struct {
+	Model         Module
+	Optimizer     Optimizer
+	Scheduler     Scheduler // the state of a StatefulScheduler is saved
+	EarlyStopping *EarlyStopping
+	Epoch         int     // the epoch to resume from, see WithInitialEpoch
+	Loss          float64 // the loss of the epoch before `Epoch`, fed to the scheduler when resuming
+	RNG           *Source // the source behind the shuffling, see WithShuffle
+}
+
+// The binary layout, all little-endian:
+//
+//	magic       [4]byte "MGCK"
+//	version     uint16
+//	epoch       uint64
+//	flags       uint8, bit 0 set if the rng is present, bit 1 if the optimizer is, bit 2 if the early stopping is,
+//	            bit 3 if the early stopping holds the parameters of the best epoch, bit 4 if it restores them
+//	rng         uint64
+//	learnrate   float64
+//	steps       uint64
+//	names       uint32 crc32 of the parameter names joined by newlines
+//	count       uint32 number of parameters
+//	params      [count]float64 data of the parameters, in the order of Parameters
+//	running     uint32 number of values of the running averages of the model
+//	averages    [running]float64 running averages of the modules of the model, in order
+//	slots       uint32 number of optimizer buffers per parameter, at most 2
+//	buffers     [count * slots]float64
+//	loss        float64
+//	scheduler   uint32 number of values of the state of the scheduler, at most 64
+//	state       [scheduler]float64
+//	best        float64 best loss of the early stopping
+//	bestepoch   int64
+//	wait        uint64
+//	patience    uint64
+//	mindelta    float64
+//	snapshot    [count]float64 parameters of the best epoch, if flagged
+//	dropouts    uint32 number of dropouts in the model
+//	sourced     [dropouts]uint8 1 if the dropout draws from a Source
+//	sources     [dropouts]uint64 states of the sources
+//	checksum    uint32 crc32 of everything above
+const (
+	checkpointHasRNG uint8 = 1 << iota
+	checkpointHasOptimizer
+	checkpointHasEarlyStopping
+	checkpointHasSnapshot
+	checkpointRestoresBest
+)
+
+// SaveCheckpoint writes `c` to `path`, see WriteCheckpoint.
+// The checkpoint is written to a temporary file renamed over `path` once complete, so a crash leaves the previous one intact.
+func SaveCheckpoint(path string, c *Checkpoint) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := WriteCheckpoint(f, c); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadCheckpoint restores `c` from `path`, see ReadCheckpoint
+func LoadCheckpoint(path string, c *Checkpoint) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ReadCheckpoint(f, c)
+}
+
+// WriteCheckpoint writes the parameters, running averages and dropout sources of the model, the optimizer buffers, the scheduler
+// and early stopping states, the epoch, the loss and the rng state of `c` to `w`.
+// The architecture of the model is not stored, save it with Save to rebuild it.
+func WriteCheckpoint(w io.Writer, c *Checkpoint) error {
+	var (
+		crc       = crc32.NewIEEE()
+		buf       = bufio.NewWriter(io.MultiWriter(w, crc))
+		params    = c.Model.Parameters()
+		flags     uint8
+		rng       uint64
+		rate      float64
+		state     = &OptimizerState{}
+		slots     = 0
+		scheduler = []float64{}
+		stopping  = EarlyStopping{}
+		snapshot  = []float64{}
+	)
+
+	if c.RNG != nil {
+		flags, rng = flags|checkpointHasRNG, c.RNG.State()
+	}
+	if c.Optimizer != nil {
+		flags, rate, state = flags|checkpointHasOptimizer, c.Optimizer.LearningRate(), c.Optimizer.State()
+		for _, b := range state.Buffers {
+			if len(b) > slots {
+				slots = len(b)
+			}
+		}
+		if slots > maxOptimizerSlots {
+			return fmt.Errorf("checkpoint: optimizer keeps %d buffers per parameter, at most %d can be saved", slots, maxOptimizerSlots)
+		}
+	}
+	if s, ok := c.Scheduler.(StatefulScheduler); ok {
+		scheduler = s.State()
+		if len(scheduler) > maxSchedulerState {
+			return fmt.Errorf("checkpoint: scheduler state holds %d values, at most %d can be saved", len(scheduler), maxSchedulerState)
+		}
+	}
+	if c.EarlyStopping != nil {
+		flags, stopping = flags|checkpointHasEarlyStopping, *c.EarlyStopping
+		if stopping.restoreBest {
+			flags |= checkpointRestoresBest
+		}
+		if stopping.snapshot != nil {
+			flags |= checkpointHasSnapshot
+			for _, p := range params {
+				snapshot = append(snapshot, stopping.snapshot[p.Name])
+			}
+		}
+	}
+
+	data := make([]float64, 0, len(params))
+	optimizerBuffers := make([]float64, 0, len(params)*slots)
+	for _, p := range params {
+		data = append(data, p.Data)
+		b := state.Buffers[p.Name]
+		for i := 0; i < slots; i++ {
+			if i < len(b) {
+				optimizerBuffers = append(optimizerBuffers, b[i])
+			} else {
+				optimizerBuffers = append(optimizerBuffers, 0)
+			}
+		}
+	}
+
+	running := []float64{}
+	for _, buffer := range buffers(c.Model) {
+		running = append(running, buffer...)
+	}
+
+	modelDropouts := dropouts(c.Model)
+	sourced, sources := make([]uint8, len(modelDropouts)), make([]uint64, len(modelDropouts))
+	for i, d := range modelDropouts {
+		if d.Source != nil {
+			sourced[i], sources[i] = 1, d.Source.State()
+		}
+	}
+
+	for _, field := range []any{
+		checkpointMagic,
+		uint16(CheckpointVersion),
+		uint64(c.Epoch),
+		flags,
+		rng,
+		rate,
+		uint64(state.Steps),
+		parameterNamesChecksum(params),
+		uint32(len(params)),
+		data,
+		uint32(len(running)),
+		running,
+		uint32(slots),
+		optimizerBuffers,
+		c.Loss,
+		uint32(len(scheduler)),
+		scheduler,
+		stopping.best,
+		int64(stopping.bestEpoch),
+		uint64(stopping.wait),
+		uint64(stopping.patience),
+		stopping.minDelta,
+		snapshot,
+		uint32(len(modelDropouts)),
+		sourced,
+		sources,
+	} {
+		if err := binary.Write(buf, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc.Sum32())
+}
+
+// ReadCheckpoint reads a checkpoint written by WriteCheckpoint from `r` into `c`.
+// `c.Model` must have the same parameters, running averages and dropouts as the model that was saved.
+// The optimizer, the scheduler, the early stopping and the rng are restored if they are set in `c` and present in the checkpoint.
+// The early stopping takes back its patience, min delta and restore best along with what it tracked.
+// Nothing is restored unless the whole checkpoint is read and its checksum matches.
+// Errors on corrupt or mismatched checkpoints wrap ErrInvalidCheckpoint.
+func ReadCheckpoint(r io.Reader, c *Checkpoint) error {
+	var (
+		crc    = crc32.NewIEEE()
+		in     = &checkpointReader{in: io.TeeReader(bufio.NewReader(r), crc)}
+		params = c.Model.Parameters()
+		header struct {
+			Magic   [4]byte
+			Version uint16
+			Epoch   uint64
+			Flags   uint8
+			RNG     uint64
+			Rate    float64
+			Steps   uint64
+			Names   uint32
+			Count   uint32
+		}
+		averages uint32
+		slots    uint32
+		loss     float64
+		size     uint32
+		stopping struct {
+			Best      float64
+			BestEpoch int64
+			Wait      uint64
+			Patience  uint64
+			MinDelta  float64
+		}
+		count    uint32
+		checksum uint32
+	)
+
+	if in.read(&header); in.err != nil {
+		return in.failure()
+	} else if header.Magic != checkpointMagic {
+		return fmt.Errorf("checkpoint: %w: not a checkpoint", ErrInvalidCheckpoint)
+	} else if header.Version != CheckpointVersion {
+		return fmt.Errorf("checkpoint: %w: unsupported version, want %d got %d", ErrInvalidCheckpoint, CheckpointVersion, header.Version)
+	} else if int(header.Count) != len(params) || header.Names != parameterNamesChecksum(params) {
+		return fmt.Errorf("checkpoint: %w: parameters do not match the model", ErrInvalidCheckpoint)
+	}
+
+	modelBuffers, values := buffers(c.Model), 0
+	for _, buffer := range modelBuffers {
+		values += len(buffer)
+	}
+	data := make([]float64, header.Count)
+	in.read(data)
+	if in.read(&averages); in.err != nil {
+		return in.failure()
+	} else if int(averages) != values {
+		return fmt.Errorf("checkpoint: %w: running averages do not match the model, want %d values got %d", ErrInvalidCheckpoint, values, averages)
+	}
+	running := make([]float64, averages)
+	in.read(running)
+	if in.read(&slots); in.err != nil {
+		return in.failure()
+	} else if slots > maxOptimizerSlots {
+		return fmt.Errorf("checkpoint: %w: %d optimizer buffers per parameter, at most %d", ErrInvalidCheckpoint, slots, maxOptimizerSlots)
+	}
+	optimizerBuffers := make([]float64, int(header.Count)*int(slots))
+	in.read(optimizerBuffers)
+	in.read(&loss)
+	if in.read(&size); in.err != nil {
+		return in.failure()
+	} else if size > maxSchedulerState {
+		return fmt.Errorf("checkpoint: %w: scheduler state of %d values, at most %d", ErrInvalidCheckpoint, size, maxSchedulerState)
+	}
+	scheduler := make([]float64, size)
+	in.read(scheduler)
+	in.read(&stopping)
+	var snapshot []float64
+	if header.Flags&checkpointHasSnapshot != 0 {
+		snapshot = make([]float64, header.Count)
+		in.read(snapshot)
+	}
+
+	modelDropouts := dropouts(c.Model)
+	if in.read(&count); in.err != nil {
+		return in.failure()
+	} else if int(count) != len(modelDropouts) {
+		return fmt.Errorf("checkpoint: %w: dropouts do not match the model, want %d got %d", ErrInvalidCheckpoint, len(modelDropouts), count)
+	}
+	sourced, sources := make([]uint8, count), make([]uint64, count)
+	in.read(sourced)
+	in.read(sources)
+
+	sum := crc.Sum32()
+	if in.read(&checksum); in.err != nil {
+		return in.failure()
+	} else if checksum != sum {
+		return fmt.Errorf("checkpoint: %w: checksum mismatch", ErrInvalidCheckpoint)
+	}
+
+	schedulerState, hasScheduler := c.Scheduler.(StatefulScheduler)
+	if hasScheduler && size > 0 {
+		if err := schedulerState.SetState(scheduler); err != nil {
+			return fmt.Errorf("checkpoint: %w: %s", ErrInvalidCheckpoint, err)
+		}
+	}
+	for i, p := range params {
+		p.Data = data[i]
+	}
+	for _, buffer := range modelBuffers {
+		running = running[copy(buffer, running):]
+	}
+	for i, d := range modelDropouts {
+		if sourced[i] == 1 && d.Source != nil {
+			d.Source.SetState(sources[i])
+		}
+	}
+	c.Epoch, c.Loss = int(header.Epoch), loss
+	if c.RNG != nil && header.Flags&checkpointHasRNG != 0 {
+		c.RNG.SetState(header.RNG)
+	}
+	if c.Optimizer != nil && header.Flags&checkpointHasOptimizer != 0 {
+		state := &OptimizerState{Steps: int(header.Steps), Buffers: map[string][]float64{}}
+		for i, p := range params {
+			if slots > 0 {
+				state.Buffers[p.Name] = optimizerBuffers[i*int(slots) : (i+1)*int(slots)]
+			}
+		}
+		c.Optimizer.SetLearningRate(header.Rate)
+		c.Optimizer.SetState(state)
+	}
+	if e := c.EarlyStopping; e != nil && header.Flags&checkpointHasEarlyStopping != 0 {
+		e.best, e.bestEpoch, e.wait, e.snapshot = stopping.Best, int(stopping.BestEpoch), int(stopping.Wait), nil
+		e.patience, e.minDelta, e.restoreBest = int(stopping.Patience), stopping.MinDelta, header.Flags&checkpointRestoresBest != 0
+		if snapshot != nil {
+			e.snapshot = map[string]float64{}
+			for i, p := range params {
+				e.snapshot[p.Name] = snapshot[i]
+			}
+		}
+	}
+	return nil
+}
+
+// checkpointReader reads the fields of a checkpoint in turn, keeping the first error
+type checkpointReader struct {
+	in  io.Reader
+	err error
+}
+
+// read reads the next field into `v`, unless a previous read failed
+func (r *checkpointReader) read(v any) {
+	if r.err == nil {
+		r.err = binary.Read(r.in, binary.LittleEndian, v)
+	}
+}
+
+// failure wraps the first read error
+func (r *checkpointReader) failure() error {
+	return fmt.Errorf("checkpoint: %w: %s", ErrInvalidCheckpoint, r.err)
+}
+
+// NewCheckpointer returns a callback saving a checkpoint of `c` to `path` at the end of every `every` epochs.
+// The saved epoch is the one following the epoch that just ended, so training resumes with it.
+// Errors writing the checkpoint stop the training and are passed to `onError` if it is not nil.
+func NewCheckpointer(path string, every int, c *Checkpoint, onError func(err error)) Callback {
+	if every <= 0 {
+		every = 1
+	}
+	return CallbackFuncs{EpochEnd: func(state *TrainingState) {
+		if (state.Epoch+1)%every != 0 {
+			return
+		}
+		c.Epoch, c.Loss = state.Epoch+1, state.Loss
+		if err := SaveCheckpoint(path, c); err != nil {
+			state.Stop = true
+			if onError != nil {
+				onError(err)
+			}
+		}
+	}}
+}
+
+// parameterNamesChecksum fingerprints the names of `params`, to tell apart models with different architectures
+func parameterNamesChecksum(params []*Parameter) uint32 {
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(names, "\n")))
+}
@@ -0,0 +1,167 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// checkpointed trains a perceptron with batch normalization and dropout for a few epochs, returning a checkpoint of every
+// part of the training along with the bytes it is written to
+func checkpointed(t *testing.T) (*Checkpoint, []byte) {
+	t.Helper()
+	x, y := [][]float64{}, [][]float64{}
+	data := rand.New(NewSource(3))
+	for i := 0; i < 16; i++ {
+		a, b := data.Float64()*2-1, data.Float64()*2-1
+		x, y = append(x, []float64{a, b}), append(y, []float64{a * b})
+	}
+
+	c := &Checkpoint{
+		Model: NewMultiLayerPerceptron("mlp", 2, []int{6, 1}, WithRand(rand.New(NewSource(5))),
+			WithNormalization(NormalizationBatch), WithDropout(0.2)),
+		Optimizer:     NewAdam(0.01),
+		Scheduler:     NewReduceOnPlateau(0.5, 0),
+		EarlyStopping: NewEarlyStopping(10, 0.001, true),
+		RNG:           NewSource(7),
+	}
+	history, err := c.Model.(*MultiLayerPerceptron).Train(4, 0.01, x, y,
+		WithBatchSize(4),
+		WithShuffle(rand.New(c.RNG)),
+		WithOptimizer(c.Optimizer),
+		WithScheduler(c.Scheduler),
+		WithEarlyStopper(c.EarlyStopping),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Epoch, c.Loss = 4, history.Epochs[3].Loss
+
+	buf := bytes.Buffer{}
+	if err := WriteCheckpoint(&buf, c); err != nil {
+		t.Fatal(err)
+	}
+	return c, buf.Bytes()
+}
+
+// freshCheckpoint is a checkpoint of the architecture of `checkpointed`, with none of its state
+func freshCheckpoint() *Checkpoint {
+	return &Checkpoint{
+		Model: NewMultiLayerPerceptron("mlp", 2, []int{6, 1}, WithRand(rand.New(NewSource(9))),
+			WithNormalization(NormalizationBatch), WithDropout(0.2)),
+		Optimizer:     NewAdam(1),
+		Scheduler:     NewReduceOnPlateau(0.5, 0),
+		EarlyStopping: NewEarlyStopping(1, 0, false),
+		RNG:           NewSource(0),
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	saved, data := checkpointed(t)
+	loaded := freshCheckpoint()
+	if err := ReadCheckpoint(bytes.NewReader(data), loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Epoch != saved.Epoch || loaded.Loss != saved.Loss {
+		t.Fatalf("resumes from epoch %d with loss %g, want %d and %g", loaded.Epoch, loaded.Loss, saved.Epoch, saved.Loss)
+	}
+	if loaded.RNG.State() != saved.RNG.State() {
+		t.Fatal("rng state not restored")
+	}
+	for i, p := range saved.Model.Parameters() {
+		if got := loaded.Model.Parameters()[i].Data; got != p.Data {
+			t.Fatalf("parameter `%s` is %g, want %g", p.Name, got, p.Data)
+		}
+	}
+	want, got := buffers(saved.Model), buffers(loaded.Model)
+	for i := range want {
+		if !equalFloats(got[i], want[i]) {
+			t.Fatalf("running averages %d are %v, want %v", i, got[i], want[i])
+		}
+	}
+	if got, want := dropouts(loaded.Model)[0].Source.State(), dropouts(saved.Model)[0].Source.State(); got != want {
+		t.Fatalf("dropout source state %d, want %d", got, want)
+	}
+
+	if loaded.Optimizer.LearningRate() != saved.Optimizer.LearningRate() {
+		t.Fatalf("learning rate %g, want %g", loaded.Optimizer.LearningRate(), saved.Optimizer.LearningRate())
+	}
+	moments, wantMoments := loaded.Optimizer.State(), saved.Optimizer.State()
+	if moments.Steps != wantMoments.Steps || len(moments.Buffers) != len(wantMoments.Buffers) {
+		t.Fatalf("optimizer has %d steps and %d buffers, want %d and %d", moments.Steps, len(moments.Buffers), wantMoments.Steps, len(wantMoments.Buffers))
+	}
+	for name, buffer := range wantMoments.Buffers {
+		if !equalFloats(moments.Buffers[name], buffer) {
+			t.Fatalf("moments of `%s` are %v, want %v", name, moments.Buffers[name], buffer)
+		}
+	}
+	if got, want := loaded.Scheduler.(StatefulScheduler).State(), saved.Scheduler.(StatefulScheduler).State(); len(want) == 0 || !equalFloats(got, want) {
+		t.Fatalf("scheduler state %v, want %v", got, want)
+	}
+
+	e, wantStopping := loaded.EarlyStopping, saved.EarlyStopping
+	if e.best != wantStopping.best || e.bestEpoch != wantStopping.bestEpoch || e.wait != wantStopping.wait {
+		t.Fatalf("early stopping tracks %g at epoch %d waiting %d, want %g at %d waiting %d", e.best, e.bestEpoch, e.wait, wantStopping.best, wantStopping.bestEpoch, wantStopping.wait)
+	}
+	if e.patience != 10 || e.minDelta != 0.001 || !e.restoreBest {
+		t.Fatalf("early stopping has patience %d, min delta %g and restore best %t, want 10, 0.001 and true", e.patience, e.minDelta, e.restoreBest)
+	}
+	if len(e.snapshot) != len(wantStopping.snapshot) {
+		t.Fatalf("snapshot of %d parameters, want %d", len(e.snapshot), len(wantStopping.snapshot))
+	}
+	for name, data := range wantStopping.snapshot {
+		if e.snapshot[name] != data {
+			t.Fatalf("snapshot of `%s` is %g, want %g", name, e.snapshot[name], data)
+		}
+	}
+}
+
+func TestCheckpointCorrupt(t *testing.T) {
+	_, data := checkpointed(t)
+	for _, size := range []int{0, 3, 20, len(data) / 2, len(data) - 1} {
+		loaded := freshCheckpoint()
+		before := loaded.Model.Parameters()[0].Data
+		if err := ReadCheckpoint(bytes.NewReader(data[:size]), loaded); !errors.Is(err, ErrInvalidCheckpoint) {
+			t.Fatalf("truncated to %d bytes: error %v, want ErrInvalidCheckpoint", size, err)
+		}
+		if loaded.Model.Parameters()[0].Data != before {
+			t.Fatalf("truncated to %d bytes: parameters restored from a rejected checkpoint", size)
+		}
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/2] ^= 0x40
+	loaded := freshCheckpoint()
+	before := loaded.Model.Parameters()[0].Data
+	if err := ReadCheckpoint(bytes.NewReader(corrupt), loaded); !errors.Is(err, ErrInvalidCheckpoint) {
+		t.Fatalf("corrupt byte: error %v, want ErrInvalidCheckpoint", err)
+	}
+	if loaded.Model.Parameters()[0].Data != before || !math.IsInf(loaded.EarlyStopping.best, 1) {
+		t.Fatal("corrupt byte: state restored from a rejected checkpoint")
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	_, data := checkpointed(t)
+
+	version := append([]byte{}, data...)
+	version[4]++
+	if err := ReadCheckpoint(bytes.NewReader(version), freshCheckpoint()); !errors.Is(err, ErrInvalidCheckpoint) {
+		t.Fatalf("wrong version: error %v, want ErrInvalidCheckpoint", err)
+	}
+
+	tests := map[string]Module{
+		"wider":               NewMultiLayerPerceptron("mlp", 2, []int{7, 1}, WithNormalization(NormalizationBatch), WithDropout(0.2)),
+		"more inputs":         NewMultiLayerPerceptron("mlp", 3, []int{6, 1}, WithNormalization(NormalizationBatch), WithDropout(0.2)),
+		"layer normalization": NewMultiLayerPerceptron("mlp", 2, []int{6, 1}, WithNormalization(NormalizationLayer), WithDropout(0.2)),
+		"no dropout":          NewMultiLayerPerceptron("mlp", 2, []int{6, 1}, WithNormalization(NormalizationBatch)),
+	}
+	for name, model := range tests {
+		if err := ReadCheckpoint(bytes.NewReader(data), &Checkpoint{Model: model}); !errors.Is(err, ErrInvalidCheckpoint) {
+			t.Fatalf("%s: error %v, want ErrInvalidCheckpoint", name, err)
+		}
+	}
+}
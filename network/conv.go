@@ -0,0 +1,449 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+)
+
+// ConvOptions configures the windows of a convolution or pooling, see NewConv1D and NewMaxPool1D
+type ConvOptions struct {
+	Stride   int // steps between two windows, defaults to 1 for convolutions and to the kernel size for poolings
+	Padding  int // zeros added at both ends of each input channel
+	Dilation int // steps between two taps of a convolution kernel, defaults to 1. Poolings take contiguous windows
+
+	layer []Option // options of the filters of a convolution
+}
+
+// ConvOption sets a field of ConvOptions. An Option is a ConvOption too, configuring the filters of a convolution.
+type ConvOption interface {
+	applyConv(o *ConvOptions)
+}
+
+// WindowOption sets the shape of the windows of a convolution or pooling
+type WindowOption func(o *ConvOptions)
+
+func (opt WindowOption) applyConv(o *ConvOptions) {
+	opt(o)
+}
+
+func (opt Option) applyConv(o *ConvOptions) {
+	o.layer = append(o.layer, opt)
+}
+
+// WithStride sets the steps between two windows of a convolution or pooling
+func WithStride(stride int) WindowOption {
+	return func(o *ConvOptions) { o.Stride = stride }
+}
+
+// WithPadding adds `padding` zeros at both ends of each input channel of a convolution or pooling
+func WithPadding(padding int) WindowOption {
+	return func(o *ConvOptions) { o.Padding = padding }
+}
+
+// WithDilation sets the steps between two taps of a convolution kernel, widening it without adding weights
+func WithDilation(dilation int) WindowOption {
+	return func(o *ConvOptions) { o.Dilation = dilation }
+}
+
+func newConvOptions(opts ...ConvOption) *ConvOptions {
+	o := &ConvOptions{}
+	for _, opt := range opts {
+		opt.applyConv(o)
+	}
+	return o
+}
+
+// Conv1D slides `OutChannels` filters along the steps of its inputs, each filter a neuron over `KernelSize` taps of every
+// input channel. Inputs and outputs are flat, channel by channel: step t of channel c is at c * steps + t, so dense
+// Layers can take the outputs directly.
+type Conv1D struct {
+	Label       string
+	Kernel      *Layer // a neuron per output channel, the weight of tap k of input channel c at c * KernelSize + k
+	InChannels  int
+	OutChannels int
+	Length      int // steps of each input channel
+	KernelSize  int
+	Stride      int // steps between two windows
+	Padding     int // zeros added at both ends of each input channel
+	Dilation    int // steps between two taps of a window
+}
+
+// NewConv1D creates a convolution of `outChannels` filters of `kernelSize` taps over `inChannels` channels of `length` steps.
+// WithStride, WithPadding and WithDilation shape the windows, 1, 0 and 1 by default. The filters are drawn and activated
+// as the neurons of a Layer, taking the same options, see NewLayer.
+// Panics if the windows do not fit the inputs.
+func NewConv1D(label string, inChannels, length, outChannels, kernelSize int, opts ...ConvOption) *Conv1D {
+	options := newConvOptions(opts...)
+	stride, dilation := options.Stride, options.Dilation
+	if stride == 0 {
+		stride = 1
+	}
+	if dilation == 0 {
+		dilation = 1
+	}
+	kernel := NewLayer(label, inChannels*kernelSize, outChannels, options.layer...)
+	conv, err := newConv1D(label, kernel, inChannels, length, kernelSize, stride, options.Padding, dilation)
+	if err != nil {
+		panic(err.Error())
+	}
+	return conv
+}
+
+// newConv1D validates the dimensions of a convolution around `kernel`
+func newConv1D(label string, kernel *Layer, inChannels, length, kernelSize, stride, padding, dilation int) (*Conv1D, error) {
+	if inChannels <= 0 || length <= 0 || kernelSize <= 0 || stride <= 0 || padding < 0 || dilation <= 0 {
+		return nil, fmt.Errorf("mismatch in conv1d `%s` dimensions: %d channels, %d steps, kernel %d, stride %d, padding %d, dilation %d",
+			label, inChannels, length, kernelSize, stride, padding, dilation)
+	} else if kernel.NumberInputs != inChannels*kernelSize {
+		return nil, fmt.Errorf("mismatch in conv1d `%s` dimensions: kernel takes %d inputs, want %d", label, kernel.NumberInputs, inChannels*kernelSize)
+	} else if windowCount(length, dilation*(kernelSize-1)+1, stride, padding) <= 0 {
+		return nil, fmt.Errorf("mismatch in conv1d `%s` dimensions: kernel %d dilated by %d is wider than %d steps padded by %d",
+			label, kernelSize, dilation, length, padding)
+	}
+	return &Conv1D{
+		Label:       label,
+		Kernel:      kernel,
+		InChannels:  inChannels,
+		OutChannels: kernel.NumberOutputs,
+		Length:      length,
+		KernelSize:  kernelSize,
+		Stride:      stride,
+		Padding:     padding,
+		Dilation:    dilation,
+	}, nil
+}
+
+// windowCount returns how many windows of `width` steps fit in `length` steps padded at both ends
+func windowCount(length, width, stride, padding int) int {
+	if length+2*padding < width {
+		return 0
+	}
+	return (length+2*padding-width)/stride + 1
+}
+
+// OutputLength returns the steps of each output channel
+func (c *Conv1D) OutputLength() int {
+	return windowCount(c.Length, c.Dilation*(c.KernelSize-1)+1, c.Stride, c.Padding)
+}
+
+// taps returns the index in the inputs of every tap of every window, window by window, -1 for the padding
+func (c *Conv1D) taps() []int {
+	taps := []int{}
+	for o := 0; o < c.OutputLength(); o++ {
+		for ch := 0; ch < c.InChannels; ch++ {
+			for k := 0; k < c.KernelSize; k++ {
+				step := o*c.Stride - c.Padding + k*c.Dilation
+				if step < 0 || step >= c.Length {
+					taps = append(taps, -1)
+				} else {
+					taps = append(taps, ch*c.Length+step)
+				}
+			}
+		}
+	}
+	return taps
+}
+
+// Forwards computes the outputs of every filter over every window of `in`.
+// `in` should have len InChannels * Length, or will panic
+func (c *Conv1D) Forwards(in []*exptree.Node) []*exptree.Node {
+	c.checkInputs(len(in))
+	steps, width := c.OutputLength(), c.InChannels*c.KernelSize
+	taps := c.taps()
+	pad := exptree.NewConstant(c.Label+"_pad", 0)
+
+	windows := [][]*exptree.Node{}
+	for o := 0; o < steps; o++ {
+		window := []*exptree.Node{}
+		for _, tap := range taps[o*width : (o+1)*width] {
+			if tap < 0 {
+				window = append(window, pad)
+			} else {
+				window = append(window, in[tap])
+			}
+		}
+		windows = append(windows, window)
+	}
+
+	output := make([]*exptree.Node, c.OutChannels*steps)
+	for o, outs := range c.Kernel.ForwardsBatch(windows) {
+		for f, out := range outs {
+			output[f*steps+o] = out
+		}
+	}
+	return output
+}
+
+// ForwardsTensor computes the outputs for a whole batch `in` of shape [batch, InChannels * Length] as a single matmul
+// of the windows by the filters, see Layer.ForwardsTensor
+func (c *Conv1D) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	c.checkInputs(in.Shape[len(in.Shape)-1])
+	batch, steps, width := in.Shape[0], c.OutputLength(), c.InChannels*c.KernelSize
+	taps := c.taps()
+
+	windows := make([]int, 0, batch*len(taps))
+	for b := 0; b < batch; b++ {
+		for _, tap := range taps {
+			if tap >= 0 {
+				tap += b * c.InputSize()
+			}
+			windows = append(windows, tap)
+		}
+	}
+	columns := exptree.Gather(c.Label+"_windows", in, []int{batch * steps, width}, windows)
+	product := c.Kernel.ForwardsTensor(columns)
+
+	// the product holds a row of channels per window, the outputs a row of windows per channel
+	channels := make([]int, 0, batch*c.OutputSize())
+	for b := 0; b < batch; b++ {
+		for f := 0; f < c.OutChannels; f++ {
+			for o := 0; o < steps; o++ {
+				channels = append(channels, (b*steps+o)*c.OutChannels+f)
+			}
+		}
+	}
+	return exptree.Gather(c.Label+"_output", product, []int{batch, c.OutputSize()}, channels)
+}
+
+// checkInputs panics if the convolution does not take `size` inputs
+func (c *Conv1D) checkInputs(size int) {
+	if size != c.InputSize() {
+		panic(fmt.Sprintf("mismatch in input dimensions: want %d, got %d", c.InputSize(), size))
+	}
+}
+
+// Parameters returns the weights and biases of the filters
+func (c *Conv1D) Parameters() []*Parameter {
+	return c.Kernel.Parameters()
+}
+
+// ZeroGradient sets the gradients of the weights and biases of the filters to 0
+func (c *Conv1D) ZeroGradient() {
+	c.Kernel.ZeroGradient()
+}
+
+// InputSize returns the steps of all input channels
+func (c *Conv1D) InputSize() int {
+	return c.InChannels * c.Length
+}
+
+// OutputSize returns the steps of all output channels
+func (c *Conv1D) OutputSize() int {
+	return c.OutChannels * c.OutputLength()
+}
+
+func (c *Conv1D) ToJSONMap() map[string]any {
+	return map[string]any{
+		"type":         ModuleConv1D,
+		"name":         c.Label,
+		"in_channels":  c.InChannels,
+		"length":       c.Length,
+		"kernel_size":  c.KernelSize,
+		"stride":       c.Stride,
+		"padding":      c.Padding,
+		"dilation":     c.Dilation,
+		"kernel":       c.Kernel.ToJSONMap(),
+		"out_channels": c.OutChannels,
+	}
+}
+
+// Pool1D takes the largest or the average value of each window of `KernelSize` steps of each channel of its inputs,
+// see NewMaxPool1D and NewAvgPool1D. Inputs and outputs are laid out as those of Conv1D.
+type Pool1D struct {
+	Label      string
+	Kind       string // ModuleMaxPool1D or ModuleAvgPool1D
+	Channels   int
+	Length     int // steps of each channel
+	KernelSize int
+	Stride     int // steps between two windows
+	Padding    int // steps added at both ends of each channel, ignored by max pooling and counted as zeros by average pooling
+}
+
+// NewMaxPool1D creates a pooling keeping the largest value of each window of `kernelSize` steps, its gradient flowing
+// to that value only. WithStride and WithPadding shape the windows, not overlapping and not padded by default.
+// Panics if the windows do not fit the inputs, or if WithDilation is given.
+func NewMaxPool1D(label string, channels, length, kernelSize int, opts ...WindowOption) *Pool1D {
+	return newPool1DFromOptions(ModuleMaxPool1D, label, channels, length, kernelSize, opts...)
+}
+
+// NewAvgPool1D creates a pooling averaging each window of `kernelSize` steps, see NewMaxPool1D
+func NewAvgPool1D(label string, channels, length, kernelSize int, opts ...WindowOption) *Pool1D {
+	return newPool1DFromOptions(ModuleAvgPool1D, label, channels, length, kernelSize, opts...)
+}
+
+func newPool1DFromOptions(kind, label string, channels, length, kernelSize int, opts ...WindowOption) *Pool1D {
+	options := &ConvOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Dilation != 0 && options.Dilation != 1 {
+		panic(fmt.Sprintf("mismatch in %s `%s` dimensions: dilation %d, poolings take contiguous windows", kind, label, options.Dilation))
+	}
+	stride := options.Stride
+	if stride == 0 {
+		stride = kernelSize
+	}
+	pool, err := newPool1D(kind, label, channels, length, kernelSize, stride, options.Padding)
+	if err != nil {
+		panic(err.Error())
+	}
+	return pool
+}
+
+// newPool1D validates the dimensions of a pooling
+func newPool1D(kind, label string, channels, length, kernelSize, stride, padding int) (*Pool1D, error) {
+	if kind != ModuleMaxPool1D && kind != ModuleAvgPool1D {
+		return nil, fmt.Errorf("unknown pooling `%s`", kind)
+	} else if channels <= 0 || length <= 0 || kernelSize <= 0 || stride <= 0 || padding < 0 {
+		return nil, fmt.Errorf("mismatch in %s `%s` dimensions: %d channels, %d steps, kernel %d, stride %d, padding %d",
+			kind, label, channels, length, kernelSize, stride, padding)
+	} else if 2*padding > kernelSize {
+		return nil, fmt.Errorf("mismatch in %s `%s` dimensions: padding %d over half the kernel %d", kind, label, padding, kernelSize)
+	} else if windowCount(length, kernelSize, stride, padding) <= 0 {
+		return nil, fmt.Errorf("mismatch in %s `%s` dimensions: kernel %d is wider than %d steps padded by %d", kind, label, kernelSize, length, padding)
+	}
+	return &Pool1D{Label: label, Kind: kind, Channels: channels, Length: length, KernelSize: kernelSize, Stride: stride, Padding: padding}, nil
+}
+
+// OutputLength returns the steps of each output channel
+func (p *Pool1D) OutputLength() int {
+	return windowCount(p.Length, p.KernelSize, p.Stride, p.Padding)
+}
+
+// taps returns the index in the inputs of every step of every window, channel by channel then window by window.
+// Padding steps are -1 for average pooling and repeat a step of the window for max pooling, which leaves the max unchanged.
+func (p *Pool1D) taps() []int {
+	taps := []int{}
+	for ch := 0; ch < p.Channels; ch++ {
+		for o := 0; o < p.OutputLength(); o++ {
+			start := o*p.Stride - p.Padding
+			first := start
+			if first < 0 {
+				first = 0
+			}
+			for k := 0; k < p.KernelSize; k++ {
+				step := start + k
+				if step >= 0 && step < p.Length {
+					taps = append(taps, ch*p.Length+step)
+				} else if p.Kind == ModuleMaxPool1D {
+					taps = append(taps, ch*p.Length+first)
+				} else {
+					taps = append(taps, -1)
+				}
+			}
+		}
+	}
+	return taps
+}
+
+// Forwards pools every window of every channel of `in`.
+// `in` should have len Channels * Length, or will panic
+func (p *Pool1D) Forwards(in []*exptree.Node) []*exptree.Node {
+	p.checkInputs(len(in))
+	taps := p.taps()
+	scale := exptree.NewConstant(p.Label+"_scale", 1/float64(p.KernelSize))
+
+	output := []*exptree.Node{}
+	for i := 0; i < p.OutputSize(); i++ {
+		label := fmt.Sprintf("%s_%d", p.Label, i)
+		window := []*exptree.Node{}
+		for _, tap := range taps[i*p.KernelSize : (i+1)*p.KernelSize] {
+			if tap >= 0 {
+				window = append(window, in[tap])
+			}
+		}
+		if p.Kind == ModuleMaxPool1D {
+			output = append(output, exptree.Max(label, window...))
+		} else {
+			output = append(output, exptree.Multiply(label, exptree.Add(label+"_sum", window...), scale))
+		}
+	}
+	return output
+}
+
+// ForwardsTensor pools a whole batch `in` of shape [batch, Channels * Length]
+func (p *Pool1D) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	p.checkInputs(in.Shape[len(in.Shape)-1])
+	batch := in.Shape[0]
+	taps := p.taps()
+
+	windows := make([]int, 0, batch*len(taps))
+	for b := 0; b < batch; b++ {
+		for _, tap := range taps {
+			if tap >= 0 {
+				tap += b * p.InputSize()
+			}
+			windows = append(windows, tap)
+		}
+	}
+	columns := exptree.Gather(p.Label+"_windows", in, []int{batch * p.OutputSize(), p.KernelSize}, windows)
+
+	var pooled *exptree.Tensor
+	if p.Kind == ModuleMaxPool1D {
+		pooled = exptree.TensorMax(p.Label+"_max", columns, 1)
+	} else {
+		pooled = exptree.TensorMean(p.Label+"_mean", columns, 1)
+	}
+	return exptree.Reshape(p.Label, pooled, batch, p.OutputSize())
+}
+
+// Predict pools every window of every channel of `in` without building an expression tree
+func (p *Pool1D) Predict(in []float64) []float64 {
+	p.checkInputs(len(in))
+	taps := p.taps()
+
+	output := make([]float64, p.OutputSize())
+	for i := range output {
+		window := taps[i*p.KernelSize : (i+1)*p.KernelSize]
+		if p.Kind == ModuleMaxPool1D {
+			output[i] = in[window[0]]
+		}
+		for _, tap := range window {
+			if tap < 0 {
+				continue
+			} else if p.Kind == ModuleMaxPool1D && in[tap] > output[i] {
+				output[i] = in[tap]
+			} else if p.Kind == ModuleAvgPool1D {
+				output[i] += in[tap] / float64(p.KernelSize)
+			}
+		}
+	}
+	return output
+}
+
+// checkInputs panics if the pooling does not take `size` inputs
+func (p *Pool1D) checkInputs(size int) {
+	if size != p.InputSize() {
+		panic(fmt.Sprintf("mismatch in input dimensions: want %d, got %d", p.InputSize(), size))
+	}
+}
+
+// Parameters returns nothing, pooling has no trainable parameters
+func (p *Pool1D) Parameters() []*Parameter {
+	return []*Parameter{}
+}
+
+// ZeroGradient does nothing, pooling has no trainable parameters
+func (p *Pool1D) ZeroGradient() {}
+
+// InputSize returns the steps of all channels
+func (p *Pool1D) InputSize() int {
+	return p.Channels * p.Length
+}
+
+// OutputSize returns the windows of all channels
+func (p *Pool1D) OutputSize() int {
+	return p.Channels * p.OutputLength()
+}
+
+func (p *Pool1D) ToJSONMap() map[string]any {
+	return map[string]any{
+		"type":        p.Kind,
+		"name":        p.Label,
+		"channels":    p.Channels,
+		"length":      p.Length,
+		"kernel_size": p.KernelSize,
+		"stride":      p.Stride,
+		"padding":     p.Padding,
+	}
+}
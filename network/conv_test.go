@@ -0,0 +1,217 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"nn/network/exptree"
+	"testing"
+)
+
+// convOutputs computes `m` for `in` through Forwards, ForwardsTensor over a batch of `in` and its negation, and predict
+func convOutputs(m TensorModule, in []float64) map[string][]float64 {
+	nodes := []*exptree.Node{}
+	negated := []float64{}
+	for i, x := range in {
+		nodes = append(nodes, exptree.NewConstant(fmt.Sprintf("in%d", i), x))
+		negated = append(negated, -x)
+	}
+	tensor := m.ForwardsTensor(exptree.TensorFromRows("in", [][]float64{negated, in}))
+	return map[string][]float64{
+		"Forwards":       nodesData(m.Forwards(nodes)),
+		"ForwardsTensor": tensor.Data[len(tensor.Data)/2:],
+		"Predict":        predict(m, in),
+	}
+}
+
+func checkConvOutputs(t *testing.T, m TensorModule, in, want []float64) {
+	t.Helper()
+	for name, got := range convOutputs(m, in) {
+		if len(got) != len(want) {
+			t.Fatalf("%s gives %d outputs, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-12 {
+				t.Fatalf("%s computes %v, want %v", name, got, want)
+			}
+		}
+	}
+}
+
+func TestConv1D(t *testing.T) {
+	// a single filter weighting the first tap by 1 and the second by 10, over 1 2 3 4 5
+	tests := []struct {
+		name string
+		opts []ConvOption
+		want []float64
+	}{
+		{"defaults", nil, []float64{21.5, 32.5, 43.5, 54.5}},
+		{"stride", []ConvOption{WithStride(2)}, []float64{21.5, 43.5}},
+		// over 0 1 2 3 4 5 0
+		{"padding", []ConvOption{WithPadding(1)}, []float64{10.5, 21.5, 32.5, 43.5, 54.5, 5.5}},
+		// taps two steps apart
+		{"dilation", []ConvOption{WithDilation(2)}, []float64{31.5, 42.5, 53.5}},
+		// windows starting at -1, 1 and 3 of the padded inputs, taps two steps apart
+		{"all", []ConvOption{WithStride(2), WithPadding(1), WithDilation(2)}, []float64{20.5, 42.5, 4.5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewConv1D("conv", 1, 5, 1, 2, append(test.opts, WithActivation(ActivationLinear))...)
+			filter := c.Kernel.Neurons[0]
+			filter.Weights[0].Data, filter.Weights[1].Data, filter.Bias.Data = 1, 10, 0.5
+			checkConvOutputs(t, c, []float64{1, 2, 3, 4, 5}, test.want)
+			if c.OutputLength() != len(test.want) {
+				t.Fatalf("output length %d, want %d", c.OutputLength(), len(test.want))
+			}
+		})
+	}
+}
+
+func TestConv1DChannels(t *testing.T) {
+	// the first filter adds the first step of channel 0 to the second of channel 1, the other the reverse
+	c := NewConv1D("conv", 2, 3, 2, 2, WithActivation(ActivationLinear), WithBiasInitializer(Zeros{}))
+	for f, weights := range [][]float64{{1, 0, 0, 1}, {0, 1, 1, 0}} {
+		for i, w := range weights {
+			c.Kernel.Neurons[f].Weights[i].Data = w
+		}
+	}
+	checkConvOutputs(t, c, []float64{1, 2, 3, 10, 20, 30}, []float64{1 + 20, 2 + 30, 2 + 10, 3 + 20})
+}
+
+func TestConv1DInvalid(t *testing.T) {
+	tests := map[string]func(){
+		"kernel wider than the inputs":  func() { NewConv1D("conv", 1, 3, 1, 4) },
+		"dilated wider than the inputs": func() { NewConv1D("conv", 1, 4, 1, 2, WithDilation(4)) },
+		"negative padding":              func() { NewConv1D("conv", 1, 4, 1, 2, WithPadding(-1)) },
+	}
+	for name, build := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("did not panic")
+				}
+			}()
+			build()
+		})
+	}
+}
+
+func TestPool1D(t *testing.T) {
+	in := []float64{-2, 5, 2, 4, 3, -1}
+	tests := []struct {
+		name     string
+		opts     []WindowOption
+		size     int
+		max, avg []float64
+	}{
+		{"not overlapping", nil, 2, []float64{5, 4, 3}, []float64{1.5, 3, 1}},
+		{"stride", []WindowOption{WithStride(1)}, 3, []float64{5, 5, 4, 4}, []float64{5.0 / 3, 11.0 / 3, 3, 2}},
+		// max pooling ignores the padding while average pooling counts it as zeros
+		{"padding", []WindowOption{WithPadding(1)}, 2, []float64{-2, 5, 4, -1}, []float64{-1, 3.5, 3.5, -0.5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkConvOutputs(t, NewMaxPool1D("max", 1, 6, test.size, test.opts...), in, test.max)
+			checkConvOutputs(t, NewAvgPool1D("avg", 1, 6, test.size, test.opts...), in, test.avg)
+		})
+	}
+
+	t.Run("channels", func(t *testing.T) {
+		checkConvOutputs(t, NewMaxPool1D("max", 2, 3, 2, WithStride(1)), in, []float64{5, 5, 4, 3})
+	})
+}
+
+func TestPool1DInvalid(t *testing.T) {
+	tests := map[string]func(){
+		"padding over half the kernel": func() { NewMaxPool1D("max", 1, 4, 2, WithPadding(2)) },
+		"dilation":                     func() { NewAvgPool1D("avg", 1, 4, 2, WithDilation(2)) },
+		"kernel wider than the inputs": func() { NewMaxPool1D("max", 1, 2, 3) },
+	}
+	for name, build := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("did not panic")
+				}
+			}()
+			build()
+		})
+	}
+}
+
+func TestConvGradients(t *testing.T) {
+	rng := rand.New(NewSource(2))
+	tests := []struct {
+		name string
+		m    TensorModule
+	}{
+		{"conv", NewConv1D("conv", 2, 6, 3, 3, WithStride(2), WithPadding(2), WithDilation(2), WithRand(rng), WithBiasInitializer(XavierUniform{}))},
+		{"max pool", NewMaxPool1D("max", 2, 6, 3, WithStride(2), WithPadding(1))},
+		{"avg pool", NewAvgPool1D("avg", 2, 6, 3, WithStride(2), WithPadding(1))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// distinct values, so every window has a single max
+			in := make([]float64, 12)
+			for i := range in {
+				in[i] = math.Sin(float64(5*i + 1))
+			}
+			nodes := rowNodes([][]float64{in})
+			root := weightedSum([][]*exptree.Node{test.m.Forwards(nodes[0])})
+			if report := exptree.GradCheck(root, 1e-6, 1e-6); !report.Passed {
+				t.Fatal(report)
+			}
+
+			// the tensor path gets the same gradients for the inputs and the parameters
+			want := []float64{}
+			for _, p := range test.m.Parameters() {
+				want = append(want, p.Gradient)
+			}
+			test.m.ZeroGradient()
+			x := exptree.TensorFromRows("x", [][]float64{in})
+			out := test.m.ForwardsTensor(x)
+			exptree.ZeroTensorGradient(out)
+			for i := range out.Gradient {
+				out.Gradient[i] = math.Sin(float64(i + 1))
+			}
+			tensors := exptree.TopologicalTensors(out)
+			for i := len(tensors) - 1; i >= 0; i-- {
+				tensors[i].GradientUpdater()
+			}
+			for j, p := range test.m.Parameters() {
+				if math.Abs(p.Gradient-want[j]) > 1e-9 {
+					t.Fatalf("tensor gradient of `%s` is %g, want %g", p.Name, p.Gradient, want[j])
+				}
+			}
+			for i, node := range nodes[0] {
+				if math.Abs(x.Gradient[i]-node.Gradient) > 1e-9 {
+					t.Fatalf("tensor gradient of input %d is %g, want %g", i, x.Gradient[i], node.Gradient)
+				}
+			}
+		})
+	}
+}
+
+func TestConvSaveLoad(t *testing.T) {
+	s := NewSequential("seq",
+		NewConv1D("conv", 2, 6, 3, 3, WithStride(2), WithPadding(2), WithDilation(2), WithRand(rand.New(NewSource(3)))),
+		NewMaxPool1D("max", 3, 3, 2, WithPadding(1)),
+		NewAvgPool1D("avg", 3, 2, 2, WithStride(1)),
+	)
+	buf := bytes.Buffer{}
+	if err := WriteModuleJSON(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadModuleJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []float64{0.1, -0.5, 0.9, 0.3, -0.2, 0.7, -0.8, 0.4, 0.6, -0.1, 0.2, -0.9}
+	if got, want := predict(loaded, in), s.Predict(in); !equalFloats(got, want) {
+		t.Fatalf("loaded model predicts %v, want %v", got, want)
+	}
+}
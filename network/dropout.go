@@ -0,0 +1,120 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"nn/network/exptree"
+)
+
+// Dropout zeroes each of its inputs with probability `Rate` while training, scaling the kept ones by 1 / (1 - Rate)
+// so their expected value is unchanged. This is inverted dropout: outside of training the inputs pass through untouched.
+type Dropout struct {
+	Label    string
+	Rate     float64
+	Rand     *rand.Rand // source of the masks
+	Source   *Source    // the source behind Rand when it is one, saved by checkpoints. Nil for a Rand set by the caller
+	Training bool       // masks are only drawn while training, see MultiLayerPerceptron.SetTraining
+}
+
+// NewDropout creates a dropout of `rate`, in [0, 1), drawing its masks from `rng`.
+// A nil `rng` uses a Source seeded from the source shared by the package, see SeedDefault.
+func NewDropout(label string, rate float64, rng *rand.Rand) *Dropout {
+	if rate < 0 || rate >= 1 {
+		panic(fmt.Sprintf("dropout rate %g out of range [0, 1)", rate))
+	}
+	if rng == nil {
+		return newSeededDropout(label, rate, defaultSource.Int63())
+	}
+	return &Dropout{Label: label, Rate: rate, Rand: rng}
+}
+
+// newSeededDropout creates a dropout drawing its masks from a Source seeded with `seed`
+func newSeededDropout(label string, rate float64, seed int64) *Dropout {
+	source := NewSource(seed)
+	d := NewDropout(label, rate, rand.New(source))
+	d.Source = source
+	return d
+}
+
+// restoreDropout creates a dropout drawing its masks from a Source at `state`, as saved by ToJSONMap,
+// or seeded with `seed` for a dropout saved without one
+func restoreDropout(label string, rate float64, state *uint64, seed int64) *Dropout {
+	d := newSeededDropout(label, rate, seed)
+	if state != nil {
+		d.Source.SetState(*state)
+	}
+	return d
+}
+
+// sourceState returns the state of the Source of the dropout, nil if it draws from a Rand set by the caller
+func (d *Dropout) sourceState() *uint64 {
+	if d.Source == nil {
+		return nil
+	}
+	state := d.Source.State()
+	return &state
+}
+
+// mask draws whether each of `size` inputs is kept, as the value it is multiplied by
+func (d *Dropout) mask(size int) []float64 {
+	mask := make([]float64, size)
+	for i := range mask {
+		if d.Rand.Float64() >= d.Rate {
+			mask[i] = 1 / (1 - d.Rate)
+		}
+	}
+	return mask
+}
+
+// Parameters returns nothing, dropout has no trainable parameters
+func (d *Dropout) Parameters() []*Parameter {
+	return []*Parameter{}
+}
+
+// ZeroGradient does nothing, dropout has no trainable parameters
+func (d *Dropout) ZeroGradient() {}
+
+// SetTraining switches between drawing masks and passing the inputs through
+func (d *Dropout) SetTraining(training bool) {
+	d.Training = training
+}
+
+// Predict returns `in` as is, dropout being skipped in inference
+func (d *Dropout) Predict(in []float64) []float64 {
+	return in
+}
+
+// ToJSONMap holds the rate of the dropout and the state of its Source, so a loaded dropout draws the masks it would have drawn next
+func (d *Dropout) ToJSONMap() map[string]any {
+	data := map[string]any{
+		"type": ModuleDropout,
+		"name": d.Label,
+		"rate": d.Rate,
+	}
+	if state := d.sourceState(); state != nil {
+		data["state"] = *state
+	}
+	return data
+}
+
+// Forwards multiplies each input by a mask node, 0 for dropped inputs, so gradients only flow through the kept ones.
+// Outside of training `in` is returned as is.
+func (d *Dropout) Forwards(in []*exptree.Node) (output []*exptree.Node) {
+	if !d.Training || d.Rate == 0 {
+		return in
+	}
+	for i, scale := range d.mask(len(in)) {
+		mask := exptree.NewConstant(fmt.Sprintf("%s_mask%d", d.Label, i), scale)
+		output = append(output, exptree.Multiply(fmt.Sprintf("%s_%d", d.Label, i), in[i], mask))
+	}
+	return output
+}
+
+// ForwardsTensor is Forwards for a whole batch, drawing a mask for every value of `in`
+func (d *Dropout) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	if !d.Training || d.Rate == 0 {
+		return in
+	}
+	mask := exptree.NewTensor(d.Label+"_mask", in.Shape, d.mask(in.Size()))
+	return exptree.TensorMultiply(d.Label, in, mask)
+}
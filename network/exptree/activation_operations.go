@@ -0,0 +1,258 @@
+package exptree
+
+import "math"
+
+// Unary computes `fn` of the data in a single node. A fresh node with the result is returned and the operand is unchanged.
+// `label` is the label of the output node and `op` the operation recorded on it.
+// `derivative` receives the input x and the output y = fn(x) and returns dy/dx, it is used to set the local gradient of output node.
+func Unary(label string, op Operation, node *Node, fn func(x float64) float64, derivative func(x, y float64) float64) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(op, node)
+	output.DataUpdater = func() {
+		output.Data = fn(node.Data)
+	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{derivative(node.Data, output.Data)}
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Elementwise is a function of a single value along with its derivative, so it can be applied to a Node, a Tensor or a plain float64
+type Elementwise struct {
+	Operation  Operation
+	Fn         func(x float64) float64
+	Derivative func(x, y float64) float64 // dy/dx given the input x and the output y = Fn(x)
+}
+
+// Node applies the function to a single node, see Unary
+func (e Elementwise) Node(label string, node *Node) *Node {
+	return Unary(label, e.Operation, node, e.Fn, e.Derivative)
+}
+
+// Tensor applies the function to every value of a tensor, see TensorUnary
+func (e Elementwise) Tensor(label string, tensor *Tensor) *Tensor {
+	return TensorUnary(label, e.Operation, tensor, e.Fn, e.Derivative)
+}
+
+// TanhFunc is the hyperbolic tangent, see Tanh
+var TanhFunc = Elementwise{
+	Operation:  OperationTanh,
+	Fn:         math.Tanh,
+	Derivative: func(x, y float64) float64 { return 1 - y*y },
+}
+
+// SigmoidFunc is the logistic function.
+// for b = 1 / (1 + exp(-a))
+// db/da = b * (1 - b)
+var SigmoidFunc = Elementwise{
+	Operation:  OperationSigmoid,
+	Fn:         sigmoid,
+	Derivative: func(x, y float64) float64 { return y * (1 - y) },
+}
+
+// Sigmoid computes the logistic function of the data in a single node, see SigmoidFunc
+func Sigmoid(label string, node *Node) *Node {
+	return SigmoidFunc.Node(label, node)
+}
+
+// ReLUFunc is the rectified linear unit.
+// for b = max(0, a)
+// db/da = 1 if a > 0, else 0
+var ReLUFunc = Elementwise{
+	Operation: OperationReLU,
+	Fn:        func(x float64) float64 { return math.Max(0, x) },
+	Derivative: func(x, y float64) float64 {
+		if x > 0 {
+			return 1
+		}
+		return 0
+	},
+}
+
+// ReLU computes the rectified linear unit of the data in a single node, see ReLUFunc
+func ReLU(label string, node *Node) *Node {
+	return ReLUFunc.Node(label, node)
+}
+
+// LeakyReLUFunc is the leaky rectified linear unit.
+// for b = a if a > 0, else alpha * a
+// db/da = 1 if a > 0, else alpha
+func LeakyReLUFunc(alpha float64) Elementwise {
+	return Elementwise{
+		Operation: OperationLeakyReLU,
+		Fn: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return alpha * x
+		},
+		Derivative: func(x, y float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return alpha
+		},
+	}
+}
+
+// LeakyReLU computes the leaky rectified linear unit of the data in a single node, see LeakyReLUFunc
+func LeakyReLU(label string, node *Node, alpha float64) *Node {
+	return LeakyReLUFunc(alpha).Node(label, node)
+}
+
+// ELUFunc is the exponential linear unit.
+// for b = a if a > 0, else alpha * (exp(a) - 1)
+// db/da = 1 if a > 0, else b + alpha
+func ELUFunc(alpha float64) Elementwise {
+	return Elementwise{
+		Operation: OperationELU,
+		Fn: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return alpha * (math.Exp(x) - 1)
+		},
+		Derivative: func(x, y float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return y + alpha
+		},
+	}
+}
+
+// ELU computes the exponential linear unit of the data in a single node, see ELUFunc
+func ELU(label string, node *Node, alpha float64) *Node {
+	return ELUFunc(alpha).Node(label, node)
+}
+
+// GELUFunc is the gaussian error linear unit, using the exact erf formulation.
+// for b = a * phi(a), phi being the standard normal cdf
+// db/da = phi(a) + a * pdf(a)
+var GELUFunc = Elementwise{
+	Operation:  OperationGELU,
+	Fn:         func(x float64) float64 { return x * normalCDF(x) },
+	Derivative: func(x, y float64) float64 { return normalCDF(x) + x*math.Exp(-x*x/2)/math.Sqrt(2*math.Pi) },
+}
+
+// GELU computes the gaussian error linear unit of the data in a single node, see GELUFunc
+func GELU(label string, node *Node) *Node {
+	return GELUFunc.Node(label, node)
+}
+
+// SoftplusFunc is the smooth approximation of ReLU.
+// for b = ln(1 + exp(a))
+// db/da = sigmoid(a)
+var SoftplusFunc = Elementwise{
+	Operation:  OperationSoftplus,
+	Fn:         func(x float64) float64 { return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x))) },
+	Derivative: func(x, y float64) float64 { return sigmoid(x) },
+}
+
+// Softplus computes the smooth approximation of ReLU of the data in a single node, see SoftplusFunc
+func Softplus(label string, node *Node) *Node {
+	return SoftplusFunc.Node(label, node)
+}
+
+// SwishFunc is the self gated activation.
+// for b = a * sigmoid(a)
+// db/da = b + sigmoid(a) * (1 - b)
+var SwishFunc = Elementwise{
+	Operation:  OperationSwish,
+	Fn:         func(x float64) float64 { return x * sigmoid(x) },
+	Derivative: func(x, y float64) float64 { return y + sigmoid(x)*(1-y) },
+}
+
+// Swish computes the self gated activation of the data in a single node, see SwishFunc
+func Swish(label string, node *Node) *Node {
+	return SwishFunc.Node(label, node)
+}
+
+// IdentityFunc passes the value through unchanged.
+// for b = a
+// db/da = 1
+var IdentityFunc = Elementwise{
+	Operation:  OperationIdentity,
+	Fn:         func(x float64) float64 { return x },
+	Derivative: func(x, y float64) float64 { return 1 },
+}
+
+// Identity passes the data in a single node through unchanged, into a fresh node
+func Identity(label string, node *Node) *Node {
+	return IdentityFunc.Node(label, node)
+}
+
+// AbsFunc is the absolute value.
+// for b = |a|
+// db/da = 1 if a > 0, -1 if a < 0, else 0
+var AbsFunc = Elementwise{
+	Operation: OperationAbs,
+	Fn:        math.Abs,
+	Derivative: func(x, y float64) float64 {
+		if x > 0 {
+			return 1
+		} else if x < 0 {
+			return -1
+		}
+		return 0
+	},
+}
+
+// Abs computes the absolute value of the data in a single node, see AbsFunc
+func Abs(label string, node *Node) *Node {
+	return AbsFunc.Node(label, node)
+}
+
+// LogCoshFunc is the log of the hyperbolic cosine, computed without overflowing for large inputs.
+// for b = ln(cosh(a))
+// db/da = tanh(a)
+var LogCoshFunc = Elementwise{
+	Operation:  OperationLogCosh,
+	Fn:         func(x float64) float64 { return math.Abs(x) + math.Log1p(math.Exp(-2*math.Abs(x))) - math.Ln2 },
+	Derivative: func(x, y float64) float64 { return math.Tanh(x) },
+}
+
+// LogCosh computes the log of the hyperbolic cosine of the data in a single node, see LogCoshFunc
+func LogCosh(label string, node *Node) *Node {
+	return LogCoshFunc.Node(label, node)
+}
+
+// HuberFunc is quadratic for values up to `delta` in magnitude and linear past it.
+// The branch is taken from the data of each pass, so the node stays correct after Forward.
+// for b = 0.5 * a ^ 2 if |a| <= delta, else delta * (|a| - 0.5 * delta)
+// db/da = a if |a| <= delta, else delta * sign(a)
+func HuberFunc(delta float64) Elementwise {
+	return Elementwise{
+		Operation: OperationHuber,
+		Fn: func(x float64) float64 {
+			if math.Abs(x) <= delta {
+				return 0.5 * x * x
+			}
+			return delta * (math.Abs(x) - 0.5*delta)
+		},
+		Derivative: func(x, y float64) float64 {
+			if math.Abs(x) <= delta {
+				return x
+			}
+			return math.Copysign(delta, x)
+		},
+	}
+}
+
+// Huber computes the huber function of the data in a single node, see HuberFunc
+func Huber(label string, node *Node, delta float64) *Node {
+	return HuberFunc(delta).Node(label, node)
+}
+
+func sigmoid(x float64) float64 {
+	if x >= 0 {
+		return 1 / (1 + math.Exp(-x))
+	}
+	e := math.Exp(x)
+	return e / (1 + e)
+}
+
+func normalCDF(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
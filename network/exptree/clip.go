@@ -0,0 +1,33 @@
+package exptree
+
+import "math"
+
+// GradientNorm returns the L2 norm of the gradients of `nodes`, i.e. sqrt(sum(g ^ 2))
+func GradientNorm(nodes ...*Node) float64 {
+	sum := 0.0
+	for _, node := range nodes {
+		sum += node.Gradient * node.Gradient
+	}
+	return math.Sqrt(sum)
+}
+
+// ClipGradientByValue limits the gradient of each of `nodes` to [-limit, limit]
+func ClipGradientByValue(limit float64, nodes ...*Node) {
+	limit = math.Abs(limit)
+	for _, node := range nodes {
+		node.Gradient = math.Max(-limit, math.Min(limit, node.Gradient))
+	}
+}
+
+// ClipGradientByNorm scales the gradients of `nodes` down so their L2 norm is at most `maxNorm`, keeping their direction.
+// The norm before clipping is returned.
+func ClipGradientByNorm(maxNorm float64, nodes ...*Node) float64 {
+	norm := GradientNorm(nodes...)
+	if norm > maxNorm && norm > 0 {
+		scale := maxNorm / norm
+		for _, node := range nodes {
+			node.Gradient *= scale
+		}
+	}
+	return norm
+}
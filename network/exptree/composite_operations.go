@@ -1,8 +1,59 @@
 package exptree
 
-// SquaredDifference computes the
+import "fmt"
+
+// SquaredDifference computes the square of the difference of `nodes`, the first node being subtracted from by all others
 func SquaredDifference(label string, nodes ...*Node) *Node {
 	diff := Sub(label+"_diff", nodes...)
-	pow := Power(label, NewNode(label+"const", 2), diff)
+	pow := Power(label, NewConstant(label+"const", 2), diff)
 	return pow
 }
+
+// Mean computes the average of data in supplied `nodes`
+// for d = (a + b + c) / 3
+// dd/da = 1 / 3
+func Mean(label string, nodes ...*Node) *Node {
+	sum := Add(label+"_sum", nodes...)
+	return Multiply(label, sum, NewConstant(label+"_inverse_count", 1.0/float64(len(nodes))))
+}
+
+// LogSoftmax computes the log of the softmax of `nodes`, one output node per input node.
+// The maximum is subtracted as a constant before exponentiating, which leaves the result unchanged but avoids overflow.
+// for yi = xi - ln(sum(exp(xj)))
+func LogSoftmax(label string, nodes ...*Node) []*Node {
+	if len(nodes) == 0 {
+		return []*Node{}
+	}
+
+	largest := nodes[0].Data
+	for _, node := range nodes[1:] {
+		if node.Data > largest {
+			largest = node.Data
+		}
+	}
+	shift := NewConstant(label+"_max", largest)
+
+	shifted, exps := []*Node{}, []*Node{}
+	for i, node := range nodes {
+		s := Sub(fmt.Sprintf("%s_shifted%d", label, i), node, shift)
+		shifted = append(shifted, s)
+		exps = append(exps, Exp(fmt.Sprintf("%s_exp%d", label, i), s))
+	}
+	logsum := Log(label+"_logsumexp", Add(label+"_sumexp", exps...))
+
+	outputs := []*Node{}
+	for i := range shifted {
+		outputs = append(outputs, Sub(fmt.Sprintf("%s%d", label, i), shifted[i], logsum))
+	}
+	return outputs
+}
+
+// Softmax computes the softmax of `nodes`, one output node per input node summing up to 1.
+// for yi = exp(xi) / sum(exp(xj))
+func Softmax(label string, nodes ...*Node) []*Node {
+	outputs := []*Node{}
+	for i, logp := range LogSoftmax(label+"_log", nodes...) {
+		outputs = append(outputs, Exp(fmt.Sprintf("%s%d", label, i), logp))
+	}
+	return outputs
+}
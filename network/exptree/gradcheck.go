@@ -0,0 +1,121 @@
+package exptree
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// GradCheckResult is the comparison of the gradient of a single leaf against its numerical estimate
+type GradCheckResult struct {
+	Node          *Node
+	Analytic      float64 // gradient computed by BackPropagate
+	Numeric       float64 // gradient estimated with central finite differences
+	AbsoluteError float64
+	RelativeError float64
+	Skipped       bool // the numeric estimate is not finite, e.g. the function is undefined around the leaf
+	Passed        bool
+}
+
+// GradCheckReport holds the results of a gradient check over all leaves of a tree
+type GradCheckReport struct {
+	Epsilon          float64
+	Tolerance        float64
+	Results          []GradCheckResult
+	MaxAbsoluteError float64
+	MaxRelativeError float64
+	Passed           bool
+}
+
+// GradCheck compares the gradients computed by BackPropagate against central finite differences
+// (f(x + epsilon) - f(x - epsilon)) / (2 * epsilon) for every leaf of the tree under `root` that is not a constant.
+// If `nodes` are supplied, only those are checked.
+// A leaf passes when either its absolute or its relative error is within `tolerance`.
+// The data of the tree is restored before returning, gradients are left as computed by BackPropagate.
+func GradCheck(root *Node, epsilon, tolerance float64, nodes ...*Node) *GradCheckReport {
+	report := &GradCheckReport{Epsilon: epsilon, Tolerance: tolerance, Passed: true}
+
+	plan := NewPlan(root)
+	if len(nodes) == 0 {
+		for _, node := range plan.Nodes {
+			if len(node.ProducedByChildren) == 0 && !node.Constant {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+
+	plan.ZeroGradient()
+	plan.BackPropagate()
+
+	for _, node := range nodes {
+		original := node.Data
+
+		node.Data = original + epsilon
+		plan.Forward()
+		plus := root.Data
+
+		node.Data = original - epsilon
+		plan.Forward()
+		minus := root.Data
+
+		node.Data = original
+		plan.Forward()
+
+		result := GradCheckResult{
+			Node:     node,
+			Analytic: node.Gradient,
+			Numeric:  (plus - minus) / (2 * epsilon),
+		}
+
+		if math.IsNaN(result.Numeric) || math.IsInf(result.Numeric, 0) {
+			result.Skipped, result.Passed = true, true
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		result.AbsoluteError = math.Abs(result.Analytic - result.Numeric)
+		if scale := math.Max(math.Abs(result.Analytic), math.Abs(result.Numeric)); scale > 0 {
+			result.RelativeError = result.AbsoluteError / scale
+		}
+		result.Passed = result.AbsoluteError <= tolerance || result.RelativeError <= tolerance
+
+		report.MaxAbsoluteError = math.Max(report.MaxAbsoluteError, result.AbsoluteError)
+		report.MaxRelativeError = math.Max(report.MaxRelativeError, result.RelativeError)
+		report.Passed = report.Passed && result.Passed
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// Failures returns the results that did not pass the check
+func (r *GradCheckReport) Failures() []GradCheckResult {
+	failed := []GradCheckResult{}
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func (r *GradCheckReport) String() string {
+	b := strings.Builder{}
+	status := "passed"
+	if !r.Passed {
+		status = "FAILED"
+	}
+	fmt.Fprintf(&b, "[GradCheck %s | Epsilon `%g` | Tolerance `%g` | Max Abs Error `%.3e` | Max Rel Error `%.3e`]\n",
+		status, r.Epsilon, r.Tolerance, r.MaxAbsoluteError, r.MaxRelativeError)
+	for _, result := range r.Results {
+		mark := "ok"
+		if result.Skipped {
+			mark = "skipped"
+		} else if !result.Passed {
+			mark = "FAIL"
+		}
+		fmt.Fprintf(&b, "\t%-7s `%s` analytic `%.6f` numeric `%.6f` abs `%.3e` rel `%.3e`\n",
+			mark, result.Node.Label, result.Analytic, result.Numeric, result.AbsoluteError, result.RelativeError)
+	}
+	return b.String()
+}
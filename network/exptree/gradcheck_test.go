@@ -0,0 +1,58 @@
+package exptree
+
+import "testing"
+
+func TestGradCheckOperations(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(a, b, c *Node) *Node
+	}{
+		{"sub", func(a, b, c *Node) *Node { return Sub("out", a, b, c) }},
+		{"multiply", func(a, b, c *Node) *Node { return Multiply("out", a, b, c) }},
+		{"multiply duplicated operands", func(a, b, c *Node) *Node { return Multiply("out", a, a, b, a) }},
+		{"power", func(a, b, c *Node) *Node { return Power("out", b, a) }},
+		{"power constant exponent", func(a, b, c *Node) *Node { return Power("out", NewConstant("two", 2), Sub("diff", a, c)) }},
+		{"divide", func(a, b, c *Node) *Node { return Divide("out", a, b, c) }},
+		{"divide duplicated operands", func(a, b, c *Node) *Node { return Divide("out", a, b, b) }},
+		{"exp", func(a, b, c *Node) *Node { return Exp("out", Multiply("product", a, b)) }},
+		{"log", func(a, b, c *Node) *Node { return Log("out", Add("sum", a, b, c)) }},
+		{"composite", func(a, b, c *Node) *Node {
+			return Add("out", Exp("exp", Sub("sub", a, b)), Log("log", Divide("div", b, c)), Power("pow", c, a))
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b, c := NewNode("a", 1.3), NewNode("b", 0.7), NewNode("c", 2.1)
+			report := GradCheck(test.build(a, b, c), 1e-6, 1e-6)
+			if !report.Passed {
+				t.Fatal(report)
+			}
+			for _, result := range report.Results {
+				if result.Node.Constant {
+					t.Fatalf("constant `%s` was checked", result.Node.Label)
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizeKeepsConstants(t *testing.T) {
+	x := NewNode("x", 3)
+	two := NewConstant("two", 2)
+	loss := Power("loss", two, Sub("diff", x, NewConstant("target", 1)))
+
+	for i := 0; i < 50; i++ {
+		ZeroGradient(loss)
+		Optimize(0.1, loss)
+	}
+	if two.Data != 2 {
+		t.Fatalf("constant exponent moved to %g", two.Data)
+	}
+	if x.Data < 0.99 || x.Data > 1.01 {
+		t.Fatalf("x converged to %g, want 1", x.Data)
+	}
+	if want := (x.Data - 1) * (x.Data - 1); loss.Data != want {
+		t.Fatalf("loss %g not recomputed, want %g", loss.Data, want)
+	}
+}
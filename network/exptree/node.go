@@ -12,10 +12,15 @@ type Node struct {
 	ProducedByChildren  []*Node
 	ProducedByOperation Operation
 	GradientUpdater     func()
+	DataUpdater         func()
+	LocalGradient       func() []float64 // partial derivatives of Data with respect to each of ProducedByChildren, nil if the operation does not provide them
+	ChildGradients      func() []float64 // gradients pushed to each of ProducedByChildren, for operations computing them as a whole instead of through LocalGradient
+	Constant            bool             // a fixed operand, e.g. the exponent of a square, never updated by Optimize nor checked by GradCheck
 }
 
 // NewNode creates a new node. you can pass in an optional `label`
 // To set other items, you have to call `SetChildren`
+// Operations set `GradientUpdater` to push the gradient to the children and `DataUpdater` to recompute `Data` from them.
 func NewNode(label string, data float64) *Node {
 
 	return (&Node{
@@ -25,9 +30,17 @@ func NewNode(label string, data float64) *Node {
 		ProducedByChildren:  []*Node{},
 		ProducedByOperation: OperationNil,
 		GradientUpdater:     func() { return },
+		DataUpdater:         func() { return },
 	})
 }
 
+// NewConstant creates a new node holding a fixed value, see Node.Constant
+func NewConstant(label string, data float64) *Node {
+	n := NewNode(label, data)
+	n.Constant = true
+	return n
+}
+
 // SetChildren sets children that created this node
 func (n *Node) SetChildren(operation Operation, operands ...*Node) *Node {
 	n.ProducedByOperation = operation
@@ -36,6 +49,33 @@ func (n *Node) SetChildren(operation Operation, operands ...*Node) *Node {
 	return n
 }
 
+// SetLocalGradient sets the partial derivatives of the node with respect to each of its children,
+// along with a GradientUpdater function pushing the gradient of the node to the children through them.
+// Unlike a bare GradientUpdater, they can be computed concurrently with those of other nodes, see BackPropagateParallel.
+func (n *Node) SetLocalGradient(local func() []float64) *Node {
+	n.LocalGradient = local
+	n.GradientUpdater = func() {
+		for i, partial := range local() {
+			n.ProducedByChildren[i].Gradient += partial * n.Gradient //+= only for the special case where nodes are duplicated
+		}
+	}
+	return n
+}
+
+// SetChildGradients sets the gradients the node pushes to each of its children, already chained through the node,
+// along with a GradientUpdater function adding them to the children.
+// It stands for SetLocalGradient when the node has no data of its own to derive, see TensorNodes.
+// `gradients` must only write to state private to the node, so it can run concurrently with other nodes, see BackPropagateParallel.
+func (n *Node) SetChildGradients(gradients func() []float64) *Node {
+	n.ChildGradients = gradients
+	n.GradientUpdater = func() {
+		for i, gradient := range gradients() {
+			n.ProducedByChildren[i].Gradient += gradient
+		}
+	}
+	return n
+}
+
 // SetLabel sets the label. Useful for printing
 func (n *Node) SetLabel(label string) *Node {
 	n.Label = label
@@ -51,6 +91,10 @@ func (n *Node) Clone(label string) *Node {
 		ProducedByChildren:  n.ProducedByChildren,
 		ProducedByOperation: n.ProducedByOperation,
 		GradientUpdater:     n.GradientUpdater,
+		DataUpdater:         n.DataUpdater,
+		LocalGradient:       n.LocalGradient,
+		ChildGradients:      n.ChildGradients,
+		Constant:            n.Constant,
 	}
 }
 
@@ -4,22 +4,28 @@ import "math"
 
 // Add computes the sum of data in supplied `nodes`. A fresh node with the result is returned and the operands are unchanged.
 // `label` is the label of the output node.
-// Sets the GradientUpdater function of output node.
+// Sets the local gradient of output node.
 // for c = a + b
 // dc/da = 1.0
 // dc/db = 1.0
 func Add(label string, nodes ...*Node) *Node {
-	sum := 0.0
-	for i := range nodes {
-		sum += nodes[i].Data
-	}
-	output := NewNode(label, sum)
+	output := NewNode(label, 0)
 	output.SetChildren(OperationAddition, nodes...)
-	output.GradientUpdater = func() {
+	output.DataUpdater = func() {
+		sum := 0.0
 		for i := range nodes {
-			nodes[i].Gradient += 1.0 * output.Gradient //+= only for the special case where nodes are duplicated
+			sum += nodes[i].Data
 		}
+		output.Data = sum
 	}
+	output.SetLocalGradient(func() []float64 {
+		local := make([]float64, len(nodes))
+		for i := range nodes {
+			local[i] = 1.0
+		}
+		return local
+	})
+	output.DataUpdater()
 	return output
 }
 
@@ -27,91 +33,263 @@ func Add(label string, nodes ...*Node) *Node {
 // The first node is subtracted from by all other nodes.
 // A fresh node with the result is returned and the operands are unchanged.
 // `label` is the label of the output node.
-// Sets the GradientUpdater function of output node.
+// Sets the local gradient of output node.
 // for d = a - b - c
-// dc/da = 1.0
-// dc/db = 1.0
+// dd/da = 1.0
+// dd/db = -1.0
+// dd/dc = -1.0
 func Sub(label string, nodes ...*Node) *Node {
-	sub := 0.0
-	if len(nodes) > 1 {
-		sub = nodes[0].Data
-		for _, node := range nodes[1:] {
-			sub -= node.Data
-		}
-	}
-
-	output := NewNode(label, sub)
+	output := NewNode(label, 0)
 	output.SetChildren(OperationSubtraction, nodes...)
-	output.GradientUpdater = func() {
-		for i := range nodes {
-			nodes[i].Gradient += 1.0 * output.Gradient //+= only for the special case where nodes are duplicated
+	output.DataUpdater = func() {
+		sub := 0.0
+		if len(nodes) > 1 {
+			sub = nodes[0].Data
+			for _, node := range nodes[1:] {
+				sub -= node.Data
+			}
 		}
+		output.Data = sub
 	}
+	output.SetLocalGradient(func() []float64 {
+		local := make([]float64, len(nodes))
+		if len(nodes) <= 1 {
+			return local
+		}
+		local[0] = 1.0
+		for i := range nodes[1:] {
+			local[i+1] = -1.0
+		}
+		return local
+	})
+	output.DataUpdater()
 	return output
 }
 
 // Multiply computes the product of data in supplied `nodes`. A fresh node with the result is returned and the operands are unchanged.
 // `label` is the label of the output node.
-// Sets the GradientUpdater function of output node.
+// Sets the local gradient of output node.
 // for d = a * b * c
 // dd/da = b * c
 // dd/db = a * c
+// Operands are told apart by position, so for d = a * a, dd/da = a + a.
 func Multiply(label string, nodes ...*Node) *Node {
-	product := 1.0
-	for i := range nodes {
-		product *= nodes[i].Data
-	}
-	output := NewNode(label, product)
+	output := NewNode(label, 0)
 	output.SetChildren(OperationMultiplication, nodes...)
-	output.GradientUpdater = func() {
+	output.DataUpdater = func() {
+		product := 1.0
+		for i := range nodes {
+			product *= nodes[i].Data
+		}
+		output.Data = product
+	}
+	output.SetLocalGradient(func() []float64 {
+		local := make([]float64, len(nodes))
 		for i := range nodes {
 			gradient := 1.0
 			for j := range nodes {
-				if nodes[j] == nodes[i] {
+				if j == i {
 					continue
 				}
-				gradient *= nodes[j].Data * output.Gradient
+				gradient *= nodes[j].Data
 			}
-			nodes[i].Gradient += gradient //+= only for the special case where nodes are duplicated
+			local[i] = gradient
 		}
-	}
+		return local
+	})
+	output.DataUpdater()
 	return output
 }
 
 // Tanh computes the tanh of the data in a single node. A fresh node with the result is returned and the operands are unchanged.
 // `label` is the label of the output node.
-// Sets the GradientUpdater function of output node.
+// Sets the local gradient of output node.
 // for b = tanh(a)
 // db/da = 1 - (tanh(a) ^ 2)
 func Tanh(label string, node *Node) *Node {
-	tanh := math.Tanh(node.Data)
-	output := NewNode(label, tanh)
+	output := NewNode(label, 0)
 	output.SetChildren(OperationTanh, node)
-	output.GradientUpdater = func() {
-		node.Gradient += (1 - math.Pow(tanh, 2)) * output.Gradient
+	output.DataUpdater = func() {
+		output.Data = math.Tanh(node.Data)
 	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{1 - math.Pow(output.Data, 2)}
+	})
+	output.DataUpdater()
 	return output
 }
 
 // Power computes the power of data in `node` to data in `power`. A fresh node with the result is returned and the operands are unchanged.
 // `label` is the label of the output node.
-// Sets the GradientUpdater function of output node taking the exponent as a constant, so:
+// Sets the local gradient of output node, so:
 // for c = a ** b
 // dc/da = (b * a ** (b - 1))
+// dc/db = (a ** b) * ln(a), only propagated where a > 0 as the log is undefined otherwise
 func Power(label string, power *Node, node *Node) *Node {
-	pow := math.Pow(node.Data, power.Data)
-	output := NewNode(label, pow)
+	output := NewNode(label, 0)
 	op := OperationPowerOf
 	if power.Data == 2 {
 		op = OperationSquare
 	} else if power.Data == 3 {
 		op = OperationCube
 	}
-	output.SetChildren(op, node)
-	output.GradientUpdater = func() {
-		node.Gradient += power.Data * math.Pow(node.Data, power.Data-1) * output.Gradient
+	output.SetChildren(op, node, power)
+	output.DataUpdater = func() {
+		output.Data = math.Pow(node.Data, power.Data)
+	}
+	output.SetLocalGradient(func() []float64 {
+		local := []float64{power.Data * math.Pow(node.Data, power.Data-1), 0}
+		if node.Data > 0 {
+			local[1] = output.Data * math.Log(node.Data)
+		}
+		return local
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Divide computes the quotient of data in supplied `nodes`.
+// The first node is divided by all other nodes.
+// A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Sets the local gradient of output node.
+// for d = a / b / c
+// dd/da = 1 / (b * c)
+// dd/db = -d / b
+func Divide(label string, nodes ...*Node) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(OperationDivision, nodes...)
+	output.DataUpdater = func() {
+		quotient := 0.0
+		if len(nodes) > 0 {
+			quotient = nodes[0].Data
+			for _, node := range nodes[1:] {
+				quotient /= node.Data
+			}
+		}
+		output.Data = quotient
+	}
+	output.SetLocalGradient(func() []float64 {
+		local := make([]float64, len(nodes))
+		if len(nodes) == 0 {
+			return local
+		}
+		divisor := 1.0
+		for _, node := range nodes[1:] {
+			divisor *= node.Data
+		}
+		local[0] = 1.0 / divisor
+		for i, node := range nodes[1:] {
+			local[i+1] = -output.Data / node.Data
+		}
+		return local
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Exp computes e raised to the data in a single node. A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Sets the local gradient of output node.
+// for b = exp(a)
+// db/da = exp(a)
+func Exp(label string, node *Node) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(OperationExp, node)
+	output.DataUpdater = func() {
+		output.Data = math.Exp(node.Data)
+	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{output.Data}
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Log computes the natural logarithm of the data in a single node. A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Sets the local gradient of output node.
+// for b = ln(a)
+// db/da = 1 / a
+func Log(label string, node *Node) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(OperationLog, node)
+	output.DataUpdater = func() {
+		output.Data = math.Log(node.Data)
+	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{1.0 / node.Data}
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Negate computes the negative of the data in a single node. A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Sets the local gradient of output node.
+// for b = -a
+// db/da = -1.0
+func Negate(label string, node *Node) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(OperationNegate, node)
+	output.DataUpdater = func() {
+		output.Data = -node.Data
+	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{-1.0}
+	})
+	output.DataUpdater()
+	return output
+}
+
+// Reciprocal computes the reciprocal of the data in a single node. A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Sets the local gradient of output node.
+// for b = 1 / a
+// db/da = -1 / (a ^ 2)
+func Reciprocal(label string, node *Node) *Node {
+	output := NewNode(label, 0)
+	output.SetChildren(OperationReciprocal, node)
+	output.DataUpdater = func() {
+		output.Data = 1.0 / node.Data
 	}
+	output.SetLocalGradient(func() []float64 {
+		return []float64{-(output.Data * output.Data)}
+	})
+	output.DataUpdater()
 	return output
 }
 
-// func MeanSquaredLoss(label string, want)
+// Max computes the largest data of the supplied `nodes`. A fresh node with the result is returned and the operands are unchanged.
+// `label` is the label of the output node.
+// Panics when no node is supplied, the maximum of nothing being undefined.
+// Sets the local gradient of output node.
+// for c = max(a, b)
+// dc/da = 1.0 if a is the first largest, 0 otherwise
+// dc/db = 1.0 if b is the first largest, 0 otherwise
+func Max(label string, nodes ...*Node) *Node {
+	if len(nodes) == 0 {
+		panic("max needs at least one node")
+	}
+	output := NewNode(label, 0)
+	output.SetChildren(OperationMax, nodes...)
+	argmax := func() int {
+		largest := 0
+		for i := range nodes {
+			if nodes[i].Data > nodes[largest].Data {
+				largest = i
+			}
+		}
+		return largest
+	}
+	output.DataUpdater = func() {
+		output.Data = nodes[argmax()].Data
+	}
+	output.SetLocalGradient(func() []float64 {
+		local := make([]float64, len(nodes))
+		local[argmax()] = 1.0
+		return local
+	})
+	output.DataUpdater()
+	return output
+}
@@ -0,0 +1,172 @@
+package exptree
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// BackPropagateParallel is BackPropagate running the nodes of each level of the tree across `workers` goroutines, see Plan.BackPropagateParallel
+func BackPropagateParallel(root *Node, workers int, deterministic bool) {
+	NewPlan(root).BackPropagateParallel(workers, deterministic)
+}
+
+// level is a set of nodes none of which produces another, so their gradients are all final once the levels above are done
+type level struct {
+	parallel []*Node  // nodes with a LocalGradient or ChildGradients, run concurrently
+	serial   []*Node  // nodes with only a GradientUpdater, run one after the other once the parallel nodes are done
+	children []*Node  // the children of the parallel nodes, each once, in the order first met
+	edges    [][]edge // for each of `children`, where its contributions come from, in the order of `parallel`
+}
+
+// edge is the i-th child of the j-th parallel node of a level
+type edge struct {
+	j, i int
+}
+
+// BackPropagateParallel sets the gradient of the root to 1 and pushes it down the tree level by level.
+// A node is put one level below the lowest of the nodes it is a child of, so the root is alone at the top.
+//
+// The local gradients of the nodes of a level, or their ChildGradients, are computed concurrently across `workers` goroutines.
+// Nodes with neither run their GradientUpdater serially once the others of the level are done.
+// With `deterministic`, the contributions to each child are added up in a fixed order, so the gradients are the same from run to run,
+// though they may differ from those of BackPropagate in the last bits as the order of the additions is not the same.
+// Otherwise, the contributions are added as soon as they are computed with atomic operations, in whatever order the workers get to them.
+func (p *Plan) BackPropagateParallel(workers int, deterministic bool) {
+	if len(p.Nodes) == 0 {
+		return
+	}
+	if p.levels == nil {
+		p.levels = p.computeLevels()
+	}
+
+	p.Root.Gradient = 1.0
+	for _, l := range p.levels {
+		if deterministic {
+			l.backPropagateDeterministic(workers)
+		} else {
+			l.backPropagateAtomic(workers)
+		}
+		for _, node := range l.serial {
+			node.GradientUpdater()
+		}
+	}
+}
+
+// computeLevels splits the nodes of the plan in levels, root first
+func (p *Plan) computeLevels() []*level {
+	depth := map[*Node]int{}
+	levels := []*level{}
+	for i := len(p.Nodes) - 1; i >= 0; i-- {
+		node := p.Nodes[i]
+		d := depth[node]
+		for _, child := range node.ProducedByChildren {
+			if depth[child] < d+1 {
+				depth[child] = d + 1
+			}
+		}
+		if len(node.ProducedByChildren) == 0 {
+			continue
+		}
+
+		for len(levels) <= d {
+			levels = append(levels, &level{})
+		}
+		l := levels[d]
+		if node.LocalGradient == nil && node.ChildGradients == nil {
+			l.serial = append(l.serial, node)
+		} else {
+			l.parallel = append(l.parallel, node)
+		}
+	}
+
+	for _, l := range levels {
+		index := map[*Node]int{}
+		for j, node := range l.parallel {
+			for i, child := range node.ProducedByChildren {
+				k, ok := index[child]
+				if !ok {
+					k = len(l.children)
+					index[child] = k
+					l.children = append(l.children, child)
+					l.edges = append(l.edges, nil)
+				}
+				l.edges[k] = append(l.edges[k], edge{j: j, i: i})
+			}
+		}
+	}
+	return levels
+}
+
+// backPropagateDeterministic computes the contributions of the parallel nodes, then adds them up child by child in the order of the edges
+func (l *level) backPropagateDeterministic(workers int) {
+	contributions := make([][]float64, len(l.parallel))
+	parallelFor(len(l.parallel), workers, func(j int) {
+		contributions[j] = contribution(l.parallel[j])
+	})
+	parallelFor(len(l.children), workers, func(k int) {
+		child := l.children[k]
+		for _, e := range l.edges[k] {
+			child.Gradient += contributions[e.j][e.i]
+		}
+	})
+}
+
+// backPropagateAtomic computes the contributions of the parallel nodes and adds them to the children right away
+func (l *level) backPropagateAtomic(workers int) {
+	parallelFor(len(l.parallel), workers, func(j int) {
+		node := l.parallel[j]
+		for i, gradient := range contribution(node) {
+			atomicAdd(&node.ProducedByChildren[i].Gradient, gradient)
+		}
+	})
+}
+
+// contribution returns what `node` adds to the gradient of each of its children
+func contribution(node *Node) []float64 {
+	if node.ChildGradients != nil {
+		return node.ChildGradients()
+	}
+	local := node.LocalGradient()
+	for i := range local {
+		local[i] *= node.Gradient
+	}
+	return local
+}
+
+// parallelFor calls fn for every index below n, split in contiguous chunks across at most `workers` goroutines
+func parallelFor(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				fn(i)
+			}
+		}(w*n/workers, (w+1)*n/workers)
+	}
+	wg.Wait()
+}
+
+// atomicAdd adds `delta` to the float64 at `addr`, safe for concurrent use
+func atomicAdd(addr *float64, delta float64) {
+	bits := (*uint64)(unsafe.Pointer(addr))
+	for {
+		old := atomic.LoadUint64(bits)
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package exptree
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// dense builds `depth` fully connected layers of `width` tanh nodes over `width` inputs, every node of a layer being
+// a child of all the nodes of the next one. Each weight is used twice, so nodes also share children within a layer.
+func dense(depth, width int) (root *Node, leaves []*Node) {
+	below := []*Node{}
+	for i := 0; i < width; i++ {
+		below = append(below, NewNode(fmt.Sprintf("x%d", i), math.Sin(float64(i))))
+	}
+	leaves = append(leaves, below...)
+
+	for d := 0; d < depth; d++ {
+		weights := []*Node{}
+		for i := 0; i < width; i++ {
+			weights = append(weights, NewNode(fmt.Sprintf("w%d_%d", d, i), math.Cos(float64(d*width+i))/float64(width)))
+		}
+		leaves = append(leaves, weights...)
+
+		layer := make([]*Node, width)
+		for i := range layer {
+			terms := []*Node{}
+			for k, x := range below {
+				terms = append(terms, Multiply("term", weights[(i+k)%width], x))
+			}
+			layer[i] = Tanh("tanh", Add("sum", terms...))
+		}
+		below = layer
+	}
+	return Add("out", below...), leaves
+}
+
+// gradients backpropagates `root` with `backPropagate` and returns the gradients of every node of the tree
+func gradients(root *Node, backPropagate func(plan *Plan)) []float64 {
+	plan := NewPlan(root)
+	plan.ZeroGradient()
+	backPropagate(plan)
+	grads := []float64{}
+	for _, node := range plan.Nodes {
+		grads = append(grads, node.Gradient)
+	}
+	return grads
+}
+
+func TestBackPropagateParallel(t *testing.T) {
+	root, _ := dense(4, 24)
+	want := gradients(root, (*Plan).BackPropagate)
+
+	for _, deterministic := range []bool{true, false} {
+		for _, workers := range []int{1, 2, 4, 8} {
+			t.Run(fmt.Sprintf("deterministic=%t/workers=%d", deterministic, workers), func(t *testing.T) {
+				got := gradients(root, func(plan *Plan) { plan.BackPropagateParallel(workers, deterministic) })
+				for i := range want {
+					if math.Abs(got[i]-want[i]) > 1e-12*math.Max(1, math.Abs(want[i])) {
+						t.Fatalf("gradient of node %d is %g, want %g", i, got[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBackPropagateParallelDeterministic(t *testing.T) {
+	root, _ := dense(4, 24)
+	plan := NewPlan(root)
+	first := gradients(root, func(plan *Plan) { plan.BackPropagateParallel(8, true) })
+
+	for run := 0; run < 20; run++ {
+		plan.ZeroGradient()
+		plan.BackPropagateParallel(8, true)
+		for i, node := range plan.Nodes {
+			if node.Gradient != first[i] {
+				t.Fatalf("run %d: gradient of node %d is %v, was %v", run, i, node.Gradient, first[i])
+			}
+		}
+	}
+}
+
+func TestBackPropagateParallelFunction(t *testing.T) {
+	root, leaves := dense(2, 8)
+	want := gradients(root, (*Plan).BackPropagate)
+	plan := NewPlan(root)
+
+	plan.ZeroGradient()
+	BackPropagateParallel(root, 4, false)
+	for i, node := range plan.Nodes {
+		if math.Abs(node.Gradient-want[i]) > 1e-12*math.Max(1, math.Abs(want[i])) {
+			t.Fatalf("gradient of node %d is %g, want %g", i, node.Gradient, want[i])
+		}
+	}
+	for _, leaf := range leaves {
+		if leaf.Gradient == 0 {
+			t.Fatalf("leaf `%s` got no gradient", leaf.Label)
+		}
+	}
+}
+
+func TestBackPropagateParallelTensorNodes(t *testing.T) {
+	// two dense layers computed as tensors, the second one gathering the nodes split from the first
+	nodes := func(label string, size int) []*Node {
+		out := []*Node{}
+		for i := 0; i < size; i++ {
+			out = append(out, NewNode(fmt.Sprintf("%s%d", label, i), math.Sin(float64(3*i+len(label)))))
+		}
+		return out
+	}
+	x, w1, w2 := nodes("x", 4*3), nodes("w1_", 3*5), nodes("w2_", 5*2)
+	hidden := TensorNodes("hidden", TensorUnary("tanh", OperationTanh,
+		MatMul("h", TensorFromNodes("x", []int{4, 3}, x), TensorFromNodes("w1", []int{3, 5}, w1)), math.Tanh,
+		func(x, y float64) float64 { return 1 - y*y }))
+	out := TensorNodes("out", MatMul("o", TensorFromNodes("hidden", []int{4, 5}, hidden), TensorFromNodes("w2", []int{5, 2}, w2)))
+	squares := []*Node{}
+	for i, o := range out {
+		squares = append(squares, Multiply(fmt.Sprintf("square%d", i), o, o))
+	}
+	root := Add("loss", squares...)
+
+	for _, l := range NewPlan(root).computeLevels() {
+		for _, node := range l.serial {
+			if node.Label == "hidden" || node.Label == "out" {
+				t.Fatalf("tensor computation `%s` runs serially", node.Label)
+			}
+		}
+	}
+
+	want := gradients(root, (*Plan).BackPropagate)
+	for _, deterministic := range []bool{true, false} {
+		got := gradients(root, func(plan *Plan) { plan.BackPropagateParallel(4, deterministic) })
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-12*math.Max(1, math.Abs(want[i])) {
+				t.Fatalf("deterministic=%t: gradient of node %d is %g, want %g", deterministic, i, got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package exptree
+
+import (
+	"fmt"
+)
+
+// Tensor is a data holder for a whole array of values, the vectorized counterpart of Node.
+// Data and Gradient are stored contiguously in row major order, `Strides` giving the step in Data for each dimension.
+type Tensor struct {
+	Label               string
+	Shape               []int
+	Strides             []int
+	Data                []float64
+	Gradient            []float64
+	ProducedByChildren  []*Tensor
+	ProducedByOperation Operation
+	GradientUpdater     func()
+	DataUpdater         func()
+
+	nodes []*Node // the nodes the data is gathered from, see TensorFromNodes
+}
+
+// NewTensor creates a new tensor of `shape` holding `data`, which is used as is and not copied.
+// A nil `data` creates a tensor of zeros. An empty `shape` is a scalar holding a single value.
+// Operations set `GradientUpdater` to push the gradient to the children and `DataUpdater` to recompute `Data` from them.
+// Panics if the length of `data` does not match `shape`.
+func NewTensor(label string, shape []int, data []float64) *Tensor {
+	size := shapeSize(shape)
+	if data == nil {
+		data = make([]float64, size)
+	} else if len(data) != size {
+		panic(fmt.Sprintf("mismatch in tensor dimensions: shape %v wants %d values, got %d", shape, size, len(data)))
+	}
+
+	return &Tensor{
+		Label:               label,
+		Shape:               append([]int{}, shape...),
+		Strides:             shapeStrides(shape),
+		Data:                data,
+		Gradient:            make([]float64, size),
+		ProducedByChildren:  []*Tensor{},
+		ProducedByOperation: OperationNil,
+		GradientUpdater:     func() { return },
+		DataUpdater:         func() { return },
+	}
+}
+
+// TensorFromRows creates a 2D tensor from `rows`, all of the same length, copying the data
+func TensorFromRows(label string, rows [][]float64) *Tensor {
+	if len(rows) == 0 {
+		return NewTensor(label, []int{0, 0}, nil)
+	}
+	data := make([]float64, 0, len(rows)*len(rows[0]))
+	for i := range rows {
+		if len(rows[i]) != len(rows[0]) {
+			panic(fmt.Sprintf("mismatch in tensor dimensions: row %d has %d values, want %d", i, len(rows[i]), len(rows[0])))
+		}
+		data = append(data, rows[i]...)
+	}
+	return NewTensor(label, []int{len(rows), len(rows[0])}, data)
+}
+
+// TensorFromNodes gathers the data of `nodes` into a tensor of `shape`, in row major order, so a tensor computation can take
+// part in a tree of nodes. The data is copied again from the nodes when the tensor is recomputed, and its gradient is added
+// to theirs when it is backpropagated. A node can be gathered more than once.
+// Panics if the number of nodes does not match `shape`.
+func TensorFromNodes(label string, shape []int, nodes []*Node) *Tensor {
+	t := NewTensor(label, shape, nil)
+	if len(nodes) != t.Size() {
+		panic(fmt.Sprintf("mismatch in tensor dimensions: shape %v wants %d nodes, got %d", shape, t.Size(), len(nodes)))
+	}
+	t.nodes = nodes
+	t.DataUpdater = func() {
+		for i, node := range nodes {
+			t.Data[i] = node.Data
+		}
+	}
+	t.GradientUpdater = func() {
+		for i, node := range nodes {
+			node.Gradient += t.Gradient[i]
+		}
+	}
+	t.DataUpdater()
+	return t
+}
+
+// TensorNodes splits `root` into a node per value, in row major order, the way back from tensors to nodes.
+// The tensors under `root` are computed as a whole by a single node produced by the nodes gathered with TensorFromNodes,
+// and producing the returned nodes: it recomputes the tensors in Forward, and backpropagates through them the gradients of
+// the returned nodes in BackPropagate.
+// The node sets ChildGradients, so BackPropagateParallel runs it alongside the other nodes of its level. The tensors under
+// `root` must then not be shared with those of another TensorNodes.
+func TensorNodes(label string, root *Tensor) []*Node {
+	tensors := TopologicalTensors(root)
+	children, index := []*Node{}, map[*Node]int{}
+	for _, t := range tensors {
+		for _, node := range t.nodes {
+			if _, ok := index[node]; !ok {
+				index[node] = len(children)
+				children = append(children, node)
+			}
+		}
+	}
+
+	outputs := make([]*Node, root.Size())
+	computation := NewNode(label, 0).SetChildren(OperationTensor, children...)
+	computation.DataUpdater = func() {
+		for _, t := range tensors {
+			t.DataUpdater()
+		}
+	}
+	computation.SetChildGradients(func() []float64 {
+		for _, t := range tensors {
+			for i := range t.Gradient {
+				t.Gradient[i] = 0
+			}
+		}
+		for i, output := range outputs {
+			root.Gradient[i] = output.Gradient
+		}
+		// the gathered tensors hand their gradients to the children below instead of adding them to the nodes
+		for i := len(tensors) - 1; i >= 0; i-- {
+			if tensors[i].nodes == nil {
+				tensors[i].GradientUpdater()
+			}
+		}
+		gradients := make([]float64, len(children))
+		for _, t := range tensors {
+			for i, node := range t.nodes {
+				gradients[index[node]] += t.Gradient[i]
+			}
+		}
+		return gradients
+	})
+
+	for i := range outputs {
+		i := i
+		outputs[i] = NewNode(fmt.Sprintf("%s_%d", label, i), root.Data[i]).SetChildren(OperationTensor, computation)
+		outputs[i].DataUpdater = func() { outputs[i].Data = root.Data[i] }
+	}
+	return outputs
+}
+
+// SetChildren sets children that created this tensor
+func (t *Tensor) SetChildren(operation Operation, operands ...*Tensor) *Tensor {
+	t.ProducedByOperation = operation
+	t.ProducedByChildren = operands
+	return t
+}
+
+// Size returns the number of values held by the tensor
+func (t *Tensor) Size() int {
+	return len(t.Data)
+}
+
+// At returns the value at `index`, one coordinate per dimension
+func (t *Tensor) At(index ...int) float64 {
+	return t.Data[t.offset(index)]
+}
+
+// Set sets the value at `index`, one coordinate per dimension
+func (t *Tensor) Set(value float64, index ...int) {
+	t.Data[t.offset(index)] = value
+}
+
+// Rows returns a copy of a 2D tensor as rows of values
+func (t *Tensor) Rows() [][]float64 {
+	if len(t.Shape) != 2 {
+		panic(fmt.Sprintf("mismatch in tensor dimensions: want 2, got shape %v", t.Shape))
+	}
+	rows := [][]float64{}
+	for i := 0; i < t.Shape[0]; i++ {
+		rows = append(rows, append([]float64{}, t.Data[i*t.Strides[0]:(i+1)*t.Strides[0]]...))
+	}
+	return rows
+}
+
+func (t *Tensor) offset(index []int) int {
+	if len(index) != len(t.Shape) {
+		panic(fmt.Sprintf("mismatch in tensor dimensions: shape %v, got index %v", t.Shape, index))
+	}
+	offset := 0
+	for i := range index {
+		if index[i] < 0 || index[i] >= t.Shape[i] {
+			panic(fmt.Sprintf("index %v out of range for shape %v", index, t.Shape))
+		}
+		offset += index[i] * t.Strides[i]
+	}
+	return offset
+}
+
+func (t *Tensor) String() string {
+	return fmt.Sprintf("[Tensor `%s` | Shape `%v` | Data `%.4f` | Gradient `%.4f`]", t.Label, t.Shape, t.Data, t.Gradient)
+}
+
+// BackPropagateTensor sets every gradient of the root to 1 and calls the GradientUpdater function of each tensor, root first
+func BackPropagateTensor(root *Tensor) {
+	for i := range root.Gradient {
+		root.Gradient[i] = 1.0
+	}
+	backPropagateTensors(TopologicalTensors(root))
+}
+
+// backPropagateTensors calls the GradientUpdater function of each of `tensors`, in reverse topological order
+func backPropagateTensors(tensors []*Tensor) {
+	for i := len(tensors) - 1; i >= 0; i-- {
+		tensors[i].GradientUpdater()
+	}
+}
+
+// ForwardTensor recomputes the data of every tensor in the tree from its children by calling the DataUpdater function of each tensor.
+// Useful after the data of the nodes a tensor is gathered from has changed, see TensorFromNodes.
+func ForwardTensor(root *Tensor) {
+	for _, t := range TopologicalTensors(root) {
+		t.DataUpdater()
+	}
+}
+
+// ZeroTensorGradient zeroes the gradients of all tensors in the tree
+func ZeroTensorGradient(root *Tensor) {
+	for _, t := range TopologicalTensors(root) {
+		for i := range t.Gradient {
+			t.Gradient[i] = 0
+		}
+	}
+}
+
+// TopologicalTensors returns every tensor of the tree under `root` once, children before the tensors they produce
+func TopologicalTensors(root *Tensor) (tensors []*Tensor) {
+	type frame struct {
+		tensor *Tensor
+		child  int
+	}
+	visited := map[*Tensor]bool{root: true}
+	stack := []frame{{tensor: root}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.child == len(top.tensor.ProducedByChildren) {
+			tensors = append(tensors, top.tensor)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		child := top.tensor.ProducedByChildren[top.child]
+		top.child++
+		if !visited[child] {
+			visited[child] = true
+			stack = append(stack, frame{tensor: child})
+		}
+	}
+	return
+}
+
+func shapeSize(shape []int) int {
+	size := 1
+	for _, dim := range shape {
+		size *= dim
+	}
+	return size
+}
+
+func shapeStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+	stride := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= shape[i]
+	}
+	return strides
+}
@@ -0,0 +1,486 @@
+package exptree
+
+import "fmt"
+
+// TensorUnary computes `fn` of every value of `tensor`. A fresh tensor with the result is returned and the operand is unchanged.
+// `derivative` receives the input x and the output y = fn(x) and returns dy/dx, see Unary.
+func TensorUnary(label string, op Operation, tensor *Tensor, fn func(x float64) float64, derivative func(x, y float64) float64) *Tensor {
+	output := NewTensor(label, tensor.Shape, nil)
+	output.DataUpdater = func() {
+		for i, x := range tensor.Data {
+			output.Data[i] = fn(x)
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(op, tensor)
+	output.GradientUpdater = func() {
+		for i, x := range tensor.Data {
+			tensor.Gradient[i] += derivative(x, output.Data[i]) * output.Gradient[i]
+		}
+	}
+	return output
+}
+
+// TensorAdd computes a + b value by value, broadcasting the shapes numpy style:
+// shapes are aligned on their last dimension, and dimensions of size 1 or missing are repeated to match the other.
+// for c = a + b
+// dc/da = 1.0
+// dc/db = 1.0, summed over the broadcast dimensions
+func TensorAdd(label string, a, b *Tensor) *Tensor {
+	return tensorBinary(label, OperationAddition, a, b,
+		func(x, y float64) float64 { return x + y },
+		func(x, y, z float64) (float64, float64) { return 1, 1 })
+}
+
+// TensorSub computes a - b value by value, broadcasting the shapes as TensorAdd does.
+// for c = a - b
+// dc/da = 1.0
+// dc/db = -1.0
+func TensorSub(label string, a, b *Tensor) *Tensor {
+	return tensorBinary(label, OperationSubtraction, a, b,
+		func(x, y float64) float64 { return x - y },
+		func(x, y, z float64) (float64, float64) { return 1, -1 })
+}
+
+// TensorMultiply computes a * b value by value, broadcasting the shapes as TensorAdd does.
+// for c = a * b
+// dc/da = b
+// dc/db = a
+func TensorMultiply(label string, a, b *Tensor) *Tensor {
+	return tensorBinary(label, OperationMultiplication, a, b,
+		func(x, y float64) float64 { return x * y },
+		func(x, y, z float64) (float64, float64) { return y, x })
+}
+
+// tensorBinary applies `fn` to each pair of values of the broadcast operands.
+// `derivative` returns the partial derivatives of z = fn(x, y) with respect to x and y.
+func tensorBinary(label string, op Operation, a, b *Tensor, fn func(x, y float64) float64, derivative func(x, y, z float64) (float64, float64)) *Tensor {
+	shape, err := broadcastShapes(a.Shape, b.Shape)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	output := NewTensor(label, shape, nil)
+	aIndex, bIndex := broadcastIndex(a.Shape, shape), broadcastIndex(b.Shape, shape)
+	output.DataUpdater = func() {
+		for i := range output.Data {
+			output.Data[i] = fn(a.Data[aIndex[i]], b.Data[bIndex[i]])
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(op, a, b)
+	output.GradientUpdater = func() {
+		for i := range output.Data {
+			x, y := a.Data[aIndex[i]], b.Data[bIndex[i]]
+			da, db := derivative(x, y, output.Data[i])
+			a.Gradient[aIndex[i]] += da * output.Gradient[i]
+			b.Gradient[bIndex[i]] += db * output.Gradient[i]
+		}
+	}
+	return output
+}
+
+// MatMul computes the matrix product of `a` of shape [m, k] and `b` of shape [k, n], giving shape [m, n].
+// for C = A @ B
+// dL/dA = dL/dC @ transpose(B)
+// dL/dB = transpose(A) @ dL/dC
+func MatMul(label string, a, b *Tensor) *Tensor {
+	if len(a.Shape) != 2 || len(b.Shape) != 2 || a.Shape[1] != b.Shape[0] {
+		panic(fmt.Sprintf("mismatch in matmul dimensions: %v @ %v", a.Shape, b.Shape))
+	}
+	m, k, n := a.Shape[0], a.Shape[1], b.Shape[1]
+
+	output := NewTensor(label, []int{m, n}, nil)
+	output.DataUpdater = func() {
+		for i := range output.Data {
+			output.Data[i] = 0
+		}
+		for i := 0; i < m; i++ {
+			for p := 0; p < k; p++ {
+				x := a.Data[i*k+p]
+				if x == 0 {
+					continue
+				}
+				row := b.Data[p*n : (p+1)*n]
+				out := output.Data[i*n : (i+1)*n]
+				for j := range row {
+					out[j] += x * row[j]
+				}
+			}
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(OperationMatMul, a, b)
+	output.GradientUpdater = func() {
+		for i := 0; i < m; i++ {
+			grad := output.Gradient[i*n : (i+1)*n]
+			for p := 0; p < k; p++ {
+				row := b.Data[p*n : (p+1)*n]
+				sum := 0.0
+				for j := range row {
+					sum += grad[j] * row[j]
+				}
+				a.Gradient[i*k+p] += sum
+
+				x := a.Data[i*k+p]
+				bgrad := b.Gradient[p*n : (p+1)*n]
+				for j := range grad {
+					bgrad[j] += x * grad[j]
+				}
+			}
+		}
+	}
+	return output
+}
+
+// Transpose swaps the two dimensions of a 2D tensor into a fresh tensor
+func Transpose(label string, tensor *Tensor) *Tensor {
+	if len(tensor.Shape) != 2 {
+		panic(fmt.Sprintf("mismatch in transpose dimensions: want 2, got shape %v", tensor.Shape))
+	}
+	m, n := tensor.Shape[0], tensor.Shape[1]
+
+	output := NewTensor(label, []int{n, m}, nil)
+	output.DataUpdater = func() {
+		for i := 0; i < m; i++ {
+			for j := 0; j < n; j++ {
+				output.Data[j*m+i] = tensor.Data[i*n+j]
+			}
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(OperationTranspose, tensor)
+	output.GradientUpdater = func() {
+		for i := 0; i < m; i++ {
+			for j := 0; j < n; j++ {
+				tensor.Gradient[i*n+j] += output.Gradient[j*m+i]
+			}
+		}
+	}
+	return output
+}
+
+// Reshape views the values of `tensor` with another `shape`, sharing the data and the gradient.
+// A single dimension of -1 is inferred from the size of the tensor.
+func Reshape(label string, tensor *Tensor, shape ...int) *Tensor {
+	shape = append([]int{}, shape...)
+	infer, known := -1, 1
+	for i, dim := range shape {
+		if dim == -1 && infer < 0 {
+			infer = i
+		} else {
+			known *= dim
+		}
+	}
+	if infer >= 0 && known > 0 {
+		shape[infer] = tensor.Size() / known
+	}
+	if shapeSize(shape) != tensor.Size() {
+		panic(fmt.Sprintf("mismatch in reshape dimensions: cannot view %v as %v", tensor.Shape, shape))
+	}
+
+	output := &Tensor{
+		Label:               label,
+		Shape:               shape,
+		Strides:             shapeStrides(shape),
+		Data:                tensor.Data,
+		Gradient:            tensor.Gradient,
+		GradientUpdater:     func() { return },
+		DataUpdater:         func() { return },
+		ProducedByChildren:  []*Tensor{},
+		ProducedByOperation: OperationNil,
+	}
+	output.SetChildren(OperationReshape, tensor)
+	return output
+}
+
+// Concat joins `tensors` along `axis` into a fresh tensor, all other dimensions having to match.
+// for c = concat(a, b)
+// dc/da = 1.0 on the values taken from a, 0 elsewhere
+func Concat(label string, axis int, tensors ...*Tensor) *Tensor {
+	if len(tensors) == 0 {
+		panic("concat needs at least one tensor")
+	}
+	first := tensors[0]
+	axis = tensorAxis(axis, first.Shape)
+	shape := append([]int{}, first.Shape...)
+	shape[axis] = 0
+	for _, t := range tensors {
+		if len(t.Shape) != len(first.Shape) {
+			panic(fmt.Sprintf("mismatch in concat dimensions: %v and %v", first.Shape, t.Shape))
+		}
+		for d := range t.Shape {
+			if d != axis && t.Shape[d] != first.Shape[d] {
+				panic(fmt.Sprintf("mismatch in concat dimensions: %v and %v along axis %d", first.Shape, t.Shape, axis))
+			}
+		}
+		shape[axis] += t.Shape[axis]
+	}
+
+	// each tensor is a run of `outer` blocks, copied block by block into the rows of the output
+	outer, inner := shapeSize(shape[:axis]), shapeSize(shape[axis+1:])
+	output := NewTensor(label, shape, nil)
+	copyBlocks := func(backward bool) {
+		offset := 0
+		for _, t := range tensors {
+			block := t.Shape[axis] * inner
+			for o := 0; o < outer; o++ {
+				from, to := o*block, o*shape[axis]*inner+offset
+				if backward {
+					for i := 0; i < block; i++ {
+						t.Gradient[from+i] += output.Gradient[to+i]
+					}
+				} else {
+					copy(output.Data[to:to+block], t.Data[from:from+block])
+				}
+			}
+			offset += block
+		}
+	}
+	output.DataUpdater = func() { copyBlocks(false) }
+	output.DataUpdater()
+	output.SetChildren(OperationConcat, tensors...)
+	output.GradientUpdater = func() { copyBlocks(true) }
+	return output
+}
+
+// Slice takes the values of `tensor` from `start` to `end`, excluded, along `axis` into a fresh tensor.
+// for b = a[start:end]
+// db/da = 1.0 on the values taken, 0 elsewhere
+func Slice(label string, tensor *Tensor, axis, start, end int) *Tensor {
+	axis = tensorAxis(axis, tensor.Shape)
+	if start < 0 || end > tensor.Shape[axis] || start > end {
+		panic(fmt.Sprintf("slice [%d:%d] out of range for axis %d of shape %v", start, end, axis, tensor.Shape))
+	}
+	shape := append([]int{}, tensor.Shape...)
+	shape[axis] = end - start
+
+	outer, inner := shapeSize(shape[:axis]), shapeSize(shape[axis+1:])
+	block, stride := shape[axis]*inner, tensor.Shape[axis]*inner
+	output := NewTensor(label, shape, nil)
+	output.DataUpdater = func() {
+		for o := 0; o < outer; o++ {
+			copy(output.Data[o*block:(o+1)*block], tensor.Data[o*stride+start*inner:])
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(OperationSlice, tensor)
+	output.GradientUpdater = func() {
+		for o := 0; o < outer; o++ {
+			for i := 0; i < block; i++ {
+				tensor.Gradient[o*stride+start*inner+i] += output.Gradient[o*block+i]
+			}
+		}
+	}
+	return output
+}
+
+// Gather picks the values of `tensor` at the flat indices `index` into a fresh tensor of `shape`, an index of -1 giving 0.
+// Indices can repeat, e.g. to lay out the sliding windows of a convolution.
+// for b[i] = a[index[i]]
+// db[i]/da[index[i]] = 1.0
+func Gather(label string, tensor *Tensor, shape []int, index []int) *Tensor {
+	output := NewTensor(label, shape, nil)
+	if len(index) != output.Size() {
+		panic(fmt.Sprintf("mismatch in gather dimensions: shape %v wants %d indices, got %d", shape, output.Size(), len(index)))
+	}
+	for _, from := range index {
+		if from >= tensor.Size() || from < -1 {
+			panic(fmt.Sprintf("gather index %d out of range for shape %v", from, tensor.Shape))
+		}
+	}
+	output.DataUpdater = func() {
+		for i, from := range index {
+			if from >= 0 {
+				output.Data[i] = tensor.Data[from]
+			}
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(OperationGather, tensor)
+	output.GradientUpdater = func() {
+		for i, from := range index {
+			if from >= 0 {
+				tensor.Gradient[from] += output.Gradient[i]
+			}
+		}
+	}
+	return output
+}
+
+// TensorMax takes the largest value of `tensor` over `axis`, dropping it from the shape.
+// for b = max(a)
+// db/da = 1.0 for the first largest value, 0 for the others
+func TensorMax(label string, tensor *Tensor, axis int) *Tensor {
+	axis = tensorAxis(axis, tensor.Shape)
+	if tensor.Shape[axis] == 0 {
+		panic(fmt.Sprintf("max over empty axis %d of shape %v", axis, tensor.Shape))
+	}
+	shape := append(append([]int{}, tensor.Shape[:axis]...), tensor.Shape[axis+1:]...)
+	outer, size, inner := shapeSize(tensor.Shape[:axis]), tensor.Shape[axis], shapeSize(tensor.Shape[axis+1:])
+
+	output := NewTensor(label, shape, nil)
+	argmax := make([]int, output.Size())
+	output.DataUpdater = func() {
+		for o := 0; o < outer; o++ {
+			for i := 0; i < inner; i++ {
+				largest := o*size*inner + i
+				for k := 1; k < size; k++ {
+					if at := (o*size+k)*inner + i; tensor.Data[at] > tensor.Data[largest] {
+						largest = at
+					}
+				}
+				argmax[o*inner+i] = largest
+				output.Data[o*inner+i] = tensor.Data[largest]
+			}
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(OperationMax, tensor)
+	output.GradientUpdater = func() {
+		for i, from := range argmax {
+			tensor.Gradient[from] += output.Gradient[i]
+		}
+	}
+	return output
+}
+
+// tensorAxis resolves a negative `axis` from the end of `shape`, panicking if it is out of range
+func tensorAxis(axis int, shape []int) int {
+	if axis < 0 {
+		axis += len(shape)
+	}
+	if axis < 0 || axis >= len(shape) {
+		panic(fmt.Sprintf("axis %d out of range for shape %v", axis, shape))
+	}
+	return axis
+}
+
+// TensorSum adds up the values of `tensor` over `axes`, dropping them from the shape.
+// Without `axes` all values are added up into a scalar tensor.
+// for b = sum(a)
+// db/da = 1.0
+func TensorSum(label string, tensor *Tensor, axes ...int) *Tensor {
+	return tensorReduce(label, OperationSum, tensor, false, axes...)
+}
+
+// TensorMean averages the values of `tensor` over `axes`, dropping them from the shape.
+// Without `axes` all values are averaged into a scalar tensor.
+// for b = sum(a) / n
+// db/da = 1 / n
+func TensorMean(label string, tensor *Tensor, axes ...int) *Tensor {
+	return tensorReduce(label, OperationMean, tensor, true, axes...)
+}
+
+func tensorReduce(label string, op Operation, tensor *Tensor, mean bool, axes ...int) *Tensor {
+	reduced := map[int]bool{}
+	if len(axes) == 0 {
+		for i := range tensor.Shape {
+			reduced[i] = true
+		}
+	}
+	for _, axis := range axes {
+		if axis < 0 {
+			axis += len(tensor.Shape)
+		}
+		if axis < 0 || axis >= len(tensor.Shape) {
+			panic(fmt.Sprintf("reduction axis %d out of range for shape %v", axis, tensor.Shape))
+		}
+		reduced[axis] = true
+	}
+
+	shape, outStrides := []int{}, make([]int, len(tensor.Shape))
+	kept := []int{}
+	for i, dim := range tensor.Shape {
+		if !reduced[i] {
+			shape = append(shape, dim)
+			kept = append(kept, i)
+		}
+	}
+	strides := shapeStrides(shape)
+	for k, i := range kept {
+		outStrides[i] = strides[k]
+	}
+
+	output := NewTensor(label, shape, nil)
+	index := projectIndex(tensor.Shape, outStrides)
+	scale := 1.0
+	if mean && output.Size() > 0 {
+		scale = float64(output.Size()) / float64(tensor.Size())
+	}
+	output.DataUpdater = func() {
+		for i := range output.Data {
+			output.Data[i] = 0
+		}
+		for i, x := range tensor.Data {
+			output.Data[index[i]] += x * scale
+		}
+	}
+	output.DataUpdater()
+	output.SetChildren(op, tensor)
+	output.GradientUpdater = func() {
+		for i := range tensor.Gradient {
+			tensor.Gradient[i] += scale * output.Gradient[index[i]]
+		}
+	}
+	return output
+}
+
+// broadcastShapes returns the shape two shapes broadcast to
+func broadcastShapes(a, b []int) ([]int, error) {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	shape := make([]int, n)
+	for i := 1; i <= n; i++ {
+		da, db := 1, 1
+		if i <= len(a) {
+			da = a[len(a)-i]
+		}
+		if i <= len(b) {
+			db = b[len(b)-i]
+		}
+		switch {
+		case da == db || db == 1:
+			shape[n-i] = da
+		case da == 1:
+			shape[n-i] = db
+		default:
+			return nil, fmt.Errorf("mismatch in broadcast dimensions: %v and %v", a, b)
+		}
+	}
+	return shape, nil
+}
+
+// broadcastIndex maps each flat index of a tensor of shape `out` to the flat index of the value of a tensor of `shape` broadcast to it
+func broadcastIndex(shape, out []int) []int {
+	strides := shapeStrides(shape)
+	outStrides := make([]int, len(out))
+	for i := 1; i <= len(shape); i++ {
+		if shape[len(shape)-i] != 1 {
+			outStrides[len(out)-i] = strides[len(shape)-i]
+		}
+	}
+	return projectIndex(out, outStrides)
+}
+
+// projectIndex maps each flat index of a tensor of `shape` to the sum of its coordinates times `strides`
+func projectIndex(shape []int, strides []int) []int {
+	index := make([]int, shapeSize(shape))
+	coords := make([]int, len(shape))
+	offset := 0
+	for i := range index {
+		index[i] = offset
+		for d := len(shape) - 1; d >= 0; d-- {
+			coords[d]++
+			offset += strides[d]
+			if coords[d] < shape[d] {
+				break
+			}
+			offset -= coords[d] * strides[d]
+			coords[d] = 0
+		}
+	}
+	return index
+}
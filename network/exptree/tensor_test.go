@@ -0,0 +1,187 @@
+package exptree
+
+import (
+	"math"
+	"testing"
+)
+
+// checkTensorGradient compares the gradients backpropagated to `inputs` with central differences of the sum of the output of `build`,
+// recomputing the output with ForwardTensor after each change of the inputs
+func checkTensorGradient(t *testing.T, build func(inputs ...*Tensor) *Tensor, inputs ...*Tensor) {
+	t.Helper()
+	const epsilon, tolerance = 1e-6, 1e-6
+
+	root := build(inputs...)
+	BackPropagateTensor(root)
+	sum := func() float64 {
+		ForwardTensor(root)
+		total := 0.0
+		for _, x := range root.Data {
+			total += x
+		}
+		return total
+	}
+
+	for _, input := range inputs {
+		for i := range input.Data {
+			data := input.Data[i]
+			input.Data[i] = data + epsilon
+			plus := sum()
+			input.Data[i] = data - epsilon
+			minus := sum()
+			input.Data[i] = data
+
+			numeric := (plus - minus) / (2 * epsilon)
+			if math.Abs(numeric-input.Gradient[i]) > tolerance*math.Max(1, math.Abs(numeric)) {
+				t.Fatalf("gradient of `%s`[%d] is %g, want %g", input.Label, i, input.Gradient[i], numeric)
+			}
+		}
+	}
+}
+
+// ramp creates a tensor of `shape` holding distinct values
+func ramp(label string, shape ...int) *Tensor {
+	t := NewTensor(label, shape, nil)
+	for i := range t.Data {
+		t.Data[i] = 0.3*float64(i) - 0.7 + 0.05*float64(i*i%7)
+	}
+	return t
+}
+
+func TestMatMul(t *testing.T) {
+	a := TensorFromRows("a", [][]float64{{1, 2, 3}, {4, 5, 6}})
+	b := TensorFromRows("b", [][]float64{{1, 0}, {0, 1}, {2, -1}})
+	want := []float64{7, -1, 16, -1}
+	out := MatMul("out", a, b)
+	for i := range want {
+		if out.Data[i] != want[i] {
+			t.Fatalf("matmul gave %v, want %v", out.Data, want)
+		}
+	}
+	if out.Shape[0] != 2 || out.Shape[1] != 2 {
+		t.Fatalf("matmul shape %v, want [2 2]", out.Shape)
+	}
+}
+
+func TestGather(t *testing.T) {
+	a := TensorFromRows("a", [][]float64{{1, 2, 3}, {4, 5, 6}})
+	out := Gather("out", a, []int{2, 3}, []int{5, 0, -1, 1, 1, 3})
+	want := []float64{6, 1, 0, 2, 2, 4}
+	for i := range want {
+		if out.Data[i] != want[i] {
+			t.Fatalf("gather gave %v, want %v", out.Data, want)
+		}
+	}
+
+	BackPropagateTensor(out)
+	if want := []float64{1, 2, 0, 1, 0, 1}; !equalData(a.Gradient, want) {
+		t.Fatalf("gather gradient %v, want %v", a.Gradient, want)
+	}
+}
+
+func TestTensorMax(t *testing.T) {
+	a := TensorFromRows("a", [][]float64{{1, 5, 3}, {7, 2, 7}})
+	rows, columns := TensorMax("rows", a, 0), TensorMax("columns", a, 1)
+	if want := []float64{7, 5, 7}; !equalData(rows.Data, want) || len(rows.Shape) != 1 || rows.Shape[0] != 3 {
+		t.Fatalf("max over rows gave %v of shape %v, want %v of shape [3]", rows.Data, rows.Shape, want)
+	}
+	if want := []float64{5, 7}; !equalData(columns.Data, want) || len(columns.Shape) != 1 || columns.Shape[0] != 2 {
+		t.Fatalf("max over columns gave %v of shape %v, want %v of shape [2]", columns.Data, columns.Shape, want)
+	}
+
+	// the gradient flows to the first of tied values only
+	BackPropagateTensor(columns)
+	if want := []float64{0, 1, 0, 1, 0, 0}; !equalData(a.Gradient, want) {
+		t.Fatalf("max gradient %v, want %v", a.Gradient, want)
+	}
+}
+
+// equalData tells whether `a` and `b` hold the same values
+func equalData(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTensorGradients(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  func(inputs ...*Tensor) *Tensor
+		shapes [][]int
+	}{
+		{"matmul", func(in ...*Tensor) *Tensor { return MatMul("out", in[0], in[1]) }, [][]int{{3, 4}, {4, 2}}},
+		{"matmul shared operand", func(in ...*Tensor) *Tensor { return MatMul("out", in[0], in[0]) }, [][]int{{3, 3}}},
+		{"add", func(in ...*Tensor) *Tensor { return TensorAdd("out", in[0], in[1]) }, [][]int{{3, 4}, {3, 4}}},
+		{"add broadcast row", func(in ...*Tensor) *Tensor { return TensorAdd("out", in[0], in[1]) }, [][]int{{3, 4}, {4}}},
+		{"add broadcast column", func(in ...*Tensor) *Tensor { return TensorAdd("out", in[0], in[1]) }, [][]int{{3, 1}, {1, 4}}},
+		{"add broadcast scalar", func(in ...*Tensor) *Tensor { return TensorAdd("out", in[0], in[1]) }, [][]int{{}, {2, 3}}},
+		{"multiply broadcast", func(in ...*Tensor) *Tensor { return TensorMultiply("out", in[0], in[1]) }, [][]int{{2, 3}, {3}}},
+		{"dense layer", func(in ...*Tensor) *Tensor {
+			return TensorUnary("out", OperationTanh, TensorAdd("biased", MatMul("product", in[0], in[1]), in[2]), math.Tanh,
+				func(x, y float64) float64 { return 1 - y*y })
+		}, [][]int{{5, 3}, {3, 2}, {2}}},
+		{"mean of squares", func(in ...*Tensor) *Tensor {
+			return TensorMean("out", TensorMultiply("square", in[0], in[0]), 0)
+		}, [][]int{{4, 3}}},
+		// weighted so repeated and padded indices get gradients other than 1
+		{"gather", func(in ...*Tensor) *Tensor {
+			return TensorMultiply("out", Gather("windows", in[0], []int{3, 2}, []int{0, 1, 1, 2, -1, 5}), in[1])
+		}, [][]int{{2, 3}, {3, 2}}},
+		{"max over rows", func(in ...*Tensor) *Tensor { return TensorMultiply("out", TensorMax("max", in[0], 0), in[1]) }, [][]int{{4, 3}, {3}}},
+		{"max over columns", func(in ...*Tensor) *Tensor { return TensorMultiply("out", TensorMax("max", in[0], -1), in[1]) }, [][]int{{4, 3}, {4}}},
+		{"max over a middle axis", func(in ...*Tensor) *Tensor {
+			return TensorMultiply("out", TensorMax("max", in[0], 1), in[1])
+		}, [][]int{{2, 3, 2}, {2, 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputs := []*Tensor{}
+			for i, shape := range test.shapes {
+				inputs = append(inputs, ramp(string(rune('a'+i)), shape...))
+			}
+			checkTensorGradient(t, test.build, inputs...)
+		})
+	}
+}
+
+func TestTensorNodes(t *testing.T) {
+	x := []*Node{NewConstant("x0", 0.5), NewConstant("x1", -1.2)}
+	w := []*Node{NewNode("w00", 0.3), NewNode("w01", -0.4), NewNode("w10", 0.8), NewNode("w11", 0.1)}
+	b := []*Node{NewNode("b0", 0.2), NewNode("b1", -0.3)}
+
+	product := MatMul("product", TensorFromNodes("x", []int{1, 2}, x), TensorFromNodes("w", []int{2, 2}, w))
+	outputs := TensorNodes("out", TensorAdd("biased", product, TensorFromNodes("b", []int{2}, b)))
+	loss := Add("loss", Multiply("square0", outputs[0], outputs[0]), Multiply("square1", outputs[1], outputs[1]))
+
+	for j := range outputs {
+		want := x[0].Data*w[j].Data + x[1].Data*w[2+j].Data + b[j].Data
+		if math.Abs(outputs[j].Data-want) > 1e-12 {
+			t.Fatalf("output %d is %g, want %g", j, outputs[j].Data, want)
+		}
+	}
+	report := GradCheck(loss, 1e-6, 1e-6)
+	if !report.Passed {
+		t.Fatal(report)
+	}
+	if len(report.Results) != len(w)+len(b) {
+		t.Fatalf("checked %d nodes, want the %d weights and biases", len(report.Results), len(w)+len(b))
+	}
+
+	// a second pass on the same tree must not pick up the gradients of the first one
+	plan := NewPlan(loss)
+	plan.ZeroGradient()
+	plan.BackPropagate()
+	first := w[0].Gradient
+	plan.ZeroGradient()
+	plan.BackPropagate()
+	if w[0].Gradient != first {
+		t.Fatalf("gradient of w00 is %g on the second pass, want %g", w[0].Gradient, first)
+	}
+}
@@ -9,16 +9,45 @@ import (
 	"github.com/google/uuid"
 )
 
-// Optimize runs a single pass of optimization in order to minimize the loss function
+// Optimize runs `passes` of gradient descent, a single one by default, in order to minimize the loss function.
+// Only the leaves of the tree that are not constants are updated, the other nodes are recomputed from them after each pass.
+// The gradients are zeroed before each pass.
 func Optimize(learnrate float64, root *Node, passes ...int) {
+	OptimizeWith(descend(learnrate), root, passes...)
+}
+
+// OptimizeWith is Optimize with the update of the leaves left to `step`, e.g. an optimizer of the network package.
+// `step` receives the leaves that are not constants in the same order on every pass.
+func OptimizeWith(step func(nodes []*Node), root *Node, passes ...int) {
 	n := 1
 	if len(passes) > 0 {
 		n = passes[0]
 	}
 
+	plan := NewPlan(root)
+	trainable := plan.Trainable()
 	for i := 0; i < n; i++ {
-		BackPropagate(root)
-		nodes := Topological(root, true)
+		plan.ZeroGradient()
+		plan.BackPropagate()
+		step(trainable)
+		plan.Forward()
+	}
+}
+
+// OptimizeClipped is Optimize with the gradients of the leaves it updates scaled down to an L2 norm of at most `maxNorm` before each update.
+// The norm of the gradients of the leaves before clipping is returned for each pass.
+func OptimizeClipped(learnrate, maxNorm float64, root *Node, passes ...int) (norms []float64) {
+	step := descend(learnrate)
+	OptimizeWith(func(nodes []*Node) {
+		norms = append(norms, ClipGradientByNorm(maxNorm, nodes...))
+		step(nodes)
+	}, root, passes...)
+	return norms
+}
+
+// descend returns a step of plain gradient descent, moving each node against its gradient by `learnrate`
+func descend(learnrate float64) func(nodes []*Node) {
+	return func(nodes []*Node) {
 		for _, node := range nodes {
 			node.Data += -math.Abs(learnrate) * node.Gradient
 		}
@@ -27,89 +56,129 @@ func Optimize(learnrate float64, root *Node, passes ...int) {
 
 // ZeroGradient zeroes all the gradients
 func ZeroGradient(root *Node) {
-	for _, node := range Topological(root, true) {
-		node.Gradient = 0
-	}
+	NewPlan(root).ZeroGradient()
+}
+
+// Forward recomputes the data of every node in the tree from its children by calling the DataUpdater function of each node.
+// Useful after the data of a leaf has been changed in place.
+func Forward(root *Node) {
+	NewPlan(root).Forward()
 }
 
 // BackPropagate traverses through the expression tree and calls the GradientUpdater function for each node
 func BackPropagate(root *Node) {
-	nodes := Topological(root, true)
-	if len(nodes) > 0 {
-		nodes[0].Gradient = 1.0
-		for i := 0; i < len(nodes); i++ {
-			nodes[i].GradientUpdater()
+	NewPlan(root).BackPropagate()
+}
+
+// Plan is the topological order of the tree under `Root`, computed once and reusable across passes
+// for as long as the structure of the tree does not change.
+type Plan struct {
+	Root  *Node
+	Nodes []*Node // every node of the tree once, children before the nodes they produce, so `Root` is last
+
+	levels []*level // computed on the first parallel pass, see BackPropagateParallel
+}
+
+// NewPlan computes the topological order of the tree under `root`
+func NewPlan(root *Node) *Plan {
+	return &Plan{Root: root, Nodes: Topological(root)}
+}
+
+// Forward recomputes the data of every node from its children, see exptree.Forward
+func (p *Plan) Forward() {
+	for _, node := range p.Nodes {
+		node.DataUpdater()
+	}
+}
+
+// BackPropagate sets the gradient of the root to 1 and calls the GradientUpdater function of each node, root first
+func (p *Plan) BackPropagate() {
+	if len(p.Nodes) == 0 {
+		return
+	}
+	p.Root.Gradient = 1.0
+	for i := len(p.Nodes) - 1; i >= 0; i-- {
+		p.Nodes[i].GradientUpdater()
+	}
+}
+
+// Trainable returns the leaves of the tree that are not constants, in topological order
+func (p *Plan) Trainable() []*Node {
+	nodes := []*Node{}
+	for _, node := range p.Nodes {
+		if len(node.ProducedByChildren) == 0 && !node.Constant {
+			nodes = append(nodes, node)
 		}
 	}
+	return nodes
+}
 
+// ZeroGradient zeroes the gradient of every node
+func (p *Plan) ZeroGradient() {
+	for _, node := range p.Nodes {
+		node.Gradient = 0
+	}
+}
+
+// frame is a node being walked along with the index of the next child to walk
+type frame struct {
+	node  *Node
+	child int
 }
 
-// Preorder recursively traverses through the tree and returns a list of nodes and edges
+// Preorder traverses through the tree and returns a list of nodes and edges.
+// The walk is iterative with a set of visited nodes, so it runs in linear time and does not grow the call stack.
 func Preorder(root *Node) (nodes []*Node, edges [][]*Node) {
-	var (
-		isVisited func(n *Node) bool
-		trace     func(n *Node)
-	)
-
-	isVisited = func(n *Node) bool {
-		for i := range nodes {
-			if nodes[i] == n {
-				return true
-			}
+	visited := map[*Node]bool{root: true}
+	nodes = append(nodes, root)
+	stack := []frame{{node: root}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.child == len(top.node.ProducedByChildren) {
+			stack = stack[:len(stack)-1]
+			continue
 		}
-		return false
-	}
 
-	trace = func(n *Node) { // trace builds a representation of the tree using preorder traversal.
-		if !isVisited(n) {
-			nodes = append(nodes, n)
-			for _, child := range n.ProducedByChildren {
-				edges = append(edges, []*Node{n, child})
-				trace(child)
-			}
+		parent, child := top.node, top.node.ProducedByChildren[top.child]
+		top.child++
+		edges = append(edges, []*Node{parent, child})
+		if !visited[child] {
+			visited[child] = true
+			nodes = append(nodes, child)
+			stack = append(stack, frame{node: child})
 		}
 	}
 
-	trace(root)
-
 	return
 }
 
-// Topological traversal
+// Topological traversal, children before the nodes they produce, or the other way around with `reverse`.
+// The walk is iterative with a set of visited nodes, so it runs in linear time and does not grow the call stack.
 func Topological(root *Node, reverse ...bool) (nodes []*Node) {
-	var (
-		visited   []*Node
-		isVisited func(n *Node) bool
-		trace     func(n *Node)
-	)
-
-	isVisited = func(n *Node) bool {
-		for i := range visited {
-			if visited[i] == n {
-				return true
-			}
+	visited := map[*Node]bool{root: true}
+	stack := []frame{{node: root}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.child == len(top.node.ProducedByChildren) {
+			nodes = append(nodes, top.node)
+			stack = stack[:len(stack)-1]
+			continue
 		}
-		return false
-	}
 
-	trace = func(n *Node) { // trace builds a representation of the tree using preorder traversal.
-		if !isVisited(n) {
-			visited = append(visited, n)
-			for _, child := range n.ProducedByChildren {
-				trace(child)
-			}
-			nodes = append(nodes, n)
+		child := top.node.ProducedByChildren[top.child]
+		top.child++
+		if !visited[child] {
+			visited[child] = true
+			stack = append(stack, frame{node: child})
 		}
 	}
 
-	trace(root)
-
 	if len(reverse) > 0 && reverse[0] {
-		n := []*Node{}
-		for i := len(nodes) - 1; i >= 0; i-- {
-			n = append(n, nodes[i])
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
 		}
-		nodes = n
 	}
 	return
 
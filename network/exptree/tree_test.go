@@ -0,0 +1,156 @@
+package exptree
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"testing"
+)
+
+// chain builds a tree `depth` operations deep, each adding `x` to the previous node
+func chain(depth int) (root, x *Node) {
+	x = NewNode("x", 0.5)
+	root = x
+	for i := 0; i < depth; i++ {
+		root = Add("chain", root, x)
+	}
+	return root, x
+}
+
+// layered builds `depth` layers of `width` nodes, each node multiplying every node of the layer below,
+// so every child is shared by all the nodes of the next layer
+func layered(depth, width int) (root *Node, leaves []*Node) {
+	for i := 0; i < width; i++ {
+		leaves = append(leaves, NewNode(fmt.Sprintf("x%d", i), 1+0.01*float64(i)))
+	}
+	below := leaves
+	for d := 0; d < depth; d++ {
+		layer := make([]*Node, width)
+		for i := range layer {
+			layer[i] = Tanh("tanh", Multiply("product", append([]*Node{NewNode("w", 0.1)}, below...)...))
+		}
+		below = layer
+	}
+	return Add("out", below...), leaves
+}
+
+func TestDeepChain(t *testing.T) {
+	// a walk recursing once per node would need well over 1MB of stack for this depth
+	const depth = 200_000
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	root, x := chain(depth)
+
+	plan := NewPlan(root)
+	if len(plan.Nodes) != depth+1 {
+		t.Fatalf("plan has %d nodes, want %d", len(plan.Nodes), depth+1)
+	}
+	if nodes, _ := Preorder(root); len(nodes) != depth+1 {
+		t.Fatalf("preorder has %d nodes, want %d", len(nodes), depth+1)
+	}
+
+	plan.BackPropagate()
+	if x.Gradient != depth+1 {
+		t.Fatalf("gradient of x %g, want %d", x.Gradient, depth+1)
+	}
+	x.Data = 1
+	plan.Forward()
+	if root.Data != depth+1 {
+		t.Fatalf("root recomputed to %g, want %d", root.Data, depth+1)
+	}
+}
+
+var sizes = []int{100, 1_000, 10_000, 100_000}
+
+func BenchmarkTopological(b *testing.B) {
+	for _, size := range sizes {
+		root, _ := chain(size)
+		b.Run(fmt.Sprintf("chain/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Topological(root)
+			}
+		})
+	}
+	for _, width := range []int{10, 30, 100} {
+		root, _ := layered(10, width)
+		b.Run(fmt.Sprintf("layered/%d", width), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Topological(root)
+			}
+		})
+	}
+}
+
+func BenchmarkPreorder(b *testing.B) {
+	for _, size := range sizes {
+		root, _ := chain(size)
+		b.Run(fmt.Sprintf("chain/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Preorder(root)
+			}
+		})
+	}
+}
+
+func BenchmarkPlanBackPropagate(b *testing.B) {
+	for _, size := range sizes {
+		root, _ := chain(size)
+		plan := NewPlan(root)
+		b.Run(fmt.Sprintf("chain/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				plan.ZeroGradient()
+				plan.BackPropagate()
+			}
+		})
+	}
+	for _, width := range []int{10, 30, 100} {
+		root, _ := layered(10, width)
+		plan := NewPlan(root)
+		b.Run(fmt.Sprintf("layered/%d", width), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				plan.ZeroGradient()
+				plan.BackPropagate()
+			}
+		})
+	}
+}
+
+func BenchmarkBackPropagate(b *testing.B) {
+	for _, size := range sizes {
+		root, _ := chain(size)
+		b.Run(fmt.Sprintf("chain/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ZeroGradient(root)
+				BackPropagate(root)
+			}
+		})
+	}
+}
+
+func BenchmarkPlanForward(b *testing.B) {
+	for _, size := range sizes {
+		root, _ := chain(size)
+		plan := NewPlan(root)
+		b.Run(fmt.Sprintf("chain/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				plan.Forward()
+			}
+		})
+	}
+}
+
+func TestOptimizeClipped(t *testing.T) {
+	x := NewNode("x", 3)
+	loss := Power("loss", NewConstant("two", 2), Sub("diff", x, NewConstant("target", 1)))
+
+	// the gradient of x is 2 * (x - 1), only the leaves being clipped and every pass starting from zeroed gradients
+	norms := OptimizeClipped(0.1, 1, loss, 2)
+	if norms[0] != 4 {
+		t.Fatalf("norm of the first pass %g, want 4", norms[0])
+	}
+	if math.Abs(norms[1]-3.8) > 1e-12 {
+		t.Fatalf("norm of the second pass %g, want 3.8", norms[1])
+	}
+	if math.Abs(x.Data-2.8) > 1e-12 {
+		t.Fatalf("x moved to %g, want 2.8 with the gradients clipped to 1", x.Data)
+	}
+}
@@ -13,6 +13,30 @@ const (
 	OperationSquare         Operation = "^2"
 	OperationCube           Operation = "^3"
 	OperationExp            Operation = "exp"
+	OperationLog            Operation = "log"
+	OperationNegate         Operation = "neg"
+	OperationReciprocal     Operation = "1/x"
 	OperationTanh           Operation = "tanh"
+	OperationSigmoid        Operation = "sigmoid"
+	OperationReLU           Operation = "relu"
+	OperationLeakyReLU      Operation = "leaky_relu"
+	OperationELU            Operation = "elu"
+	OperationGELU           Operation = "gelu"
+	OperationSoftplus       Operation = "softplus"
+	OperationSwish          Operation = "swish"
+	OperationIdentity       Operation = "id"
+	OperationAbs            Operation = "abs"
+	OperationLogCosh        Operation = "logcosh"
+	OperationHuber          Operation = "huber"
+	OperationMatMul         Operation = "@"
+	OperationTranspose      Operation = "T"
+	OperationReshape        Operation = "reshape"
+	OperationSum            Operation = "sum"
+	OperationMean           Operation = "mean"
+	OperationConcat         Operation = "concat"
+	OperationSlice          Operation = "slice"
+	OperationGather         Operation = "gather"
+	OperationMax            Operation = "max"
+	OperationTensor         Operation = "tensor"
 	OperationNil            Operation = "_noop_"
 )
@@ -0,0 +1,66 @@
+package network
+
+import "nn/network/exptree"
+
+// GradientNorm returns the global L2 norm of the gradients of `params`, i.e. sqrt(sum(g ^ 2))
+func GradientNorm(params []*Parameter) float64 {
+	return exptree.GradientNorm(parameterNodes(params)...)
+}
+
+// GradientClipper limits the gradients of the parameters in place, before the optimizer step, see WithGradientClipping
+type GradientClipper interface {
+	Clip(params []*Parameter)
+}
+
+// ClipByValue limits each gradient to [-Limit, Limit]
+type ClipByValue struct {
+	Limit float64
+}
+
+// Clip implements GradientClipper
+func (c ClipByValue) Clip(params []*Parameter) {
+	exptree.ClipGradientByValue(c.Limit, parameterNodes(params)...)
+}
+
+// ClipByGlobalNorm scales all the gradients down together so their global L2 norm is at most MaxNorm
+type ClipByGlobalNorm struct {
+	MaxNorm float64
+}
+
+// Clip implements GradientClipper
+func (c ClipByGlobalNorm) Clip(params []*Parameter) {
+	exptree.ClipGradientByNorm(c.MaxNorm, parameterNodes(params)...)
+}
+
+// ClipByNorm scales the gradients of each group of parameters down so their L2 norm is at most MaxNorm.
+// A group is a kind of parameters of a layer, e.g. the weights of a layer or its biases.
+type ClipByNorm struct {
+	MaxNorm float64
+}
+
+// Clip implements GradientClipper
+func (c ClipByNorm) Clip(params []*Parameter) {
+	type group struct {
+		layer string
+		kind  ParameterKind
+	}
+	order, groups := []group{}, map[group][]*exptree.Node{}
+	for _, p := range params {
+		g := group{layer: p.Layer, kind: p.Kind}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], p.Node)
+	}
+	for _, g := range order {
+		exptree.ClipGradientByNorm(c.MaxNorm, groups[g]...)
+	}
+}
+
+func parameterNodes(params []*Parameter) []*exptree.Node {
+	nodes := []*exptree.Node{}
+	for _, p := range params {
+		nodes = append(nodes, p.Node)
+	}
+	return nodes
+}
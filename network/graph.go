@@ -0,0 +1,540 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"nn/network/exptree"
+	"strings"
+)
+
+// MergeConcat and MergeAdd are the ways a graph node combines the outputs it takes, see GraphNode
+const (
+	MergeConcat = "concat"
+	MergeAdd    = "add"
+)
+
+// ErrInvalidGraph is wrapped by the errors returned when a graph does not validate, see NewGraph
+var ErrInvalidGraph = errors.New("invalid graph")
+
+// GraphInput is an input of a graph, taking the next `Size` values of the inputs of the graph
+type GraphInput struct {
+	Name string
+	Size int
+}
+
+// GraphNode is a module of a graph fed by the outputs of the inputs and nodes named in `From`
+type GraphNode struct {
+	Name     string
+	Module   Module   // applied to the merge of `From`, nil passes the merge through
+	From     []string // the inputs and nodes feeding this node
+	Merge    string   // how several `From` are combined, MergeConcat if empty
+	Residual bool     // adds the merge to the outputs of Module, as a skip connection
+}
+
+// Graph is a model whose modules can take the outputs of any input or node, for skip connections, multiple inputs and
+// multiple outputs. The inputs of the graph are split between its Inputs in order, and its outputs are the outputs of
+// Outputs concatenated in order, see JoinInputs and SplitOutputs.
+type Graph struct {
+	Label   string
+	Inputs  []GraphInput
+	Nodes   []GraphNode // sorted so every node comes after the nodes it takes
+	Outputs []string    // the inputs and nodes giving the outputs of the graph
+
+	sizes    map[string]int // number of outputs of each input and node
+	training bool
+}
+
+// NewGraph validates a graph and sorts its nodes in the order they are computed.
+// Names must be unique, every node must take existing inputs or nodes without cycles, nodes added together must have
+// as many outputs, and Sized modules must get as many inputs as they want. Errors wrap ErrInvalidGraph.
+func NewGraph(label string, inputs []GraphInput, nodes []GraphNode, outputs []string) (*Graph, error) {
+	g := &Graph{
+		Label:   label,
+		Inputs:  append([]GraphInput{}, inputs...),
+		Outputs: append([]string{}, outputs...),
+		sizes:   map[string]int{},
+	}
+
+	declared := map[string]bool{}
+	for _, input := range inputs {
+		if err := g.declare(declared, input.Name); err != nil {
+			return nil, err
+		} else if input.Size <= 0 {
+			return nil, fmt.Errorf("graph: %w: input `%s` has size %d", ErrInvalidGraph, input.Name, input.Size)
+		}
+		g.sizes[input.Name] = input.Size
+	}
+	for _, node := range nodes {
+		if err := g.declare(declared, node.Name); err != nil {
+			return nil, err
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("graph: %w: no inputs", ErrInvalidGraph)
+	}
+
+	pending := []GraphNode{}
+	for _, node := range nodes {
+		if len(node.From) == 0 {
+			return nil, fmt.Errorf("graph: %w: node `%s` takes nothing", ErrInvalidGraph, node.Name)
+		}
+		for _, from := range node.From {
+			if !declared[from] {
+				return nil, fmt.Errorf("graph: %w: node `%s` takes unknown `%s`", ErrInvalidGraph, node.Name, from)
+			}
+		}
+		if node.Merge == "" {
+			node.Merge = MergeConcat
+		} else if node.Merge != MergeConcat && node.Merge != MergeAdd {
+			return nil, fmt.Errorf("graph: %w: node `%s` has unknown merge `%s`", ErrInvalidGraph, node.Name, node.Merge)
+		}
+		node.From = append([]string{}, node.From...)
+		pending = append(pending, node)
+	}
+
+	// repeatedly take the nodes whose inputs are all computed, keeping the declared order among them
+	for len(pending) > 0 {
+		left := []GraphNode{}
+		for _, node := range pending {
+			ready := true
+			for _, from := range node.From {
+				if _, ok := g.sizes[from]; !ok {
+					ready = false
+				}
+			}
+			if !ready {
+				left = append(left, node)
+				continue
+			}
+			size, err := g.nodeSize(node)
+			if err != nil {
+				return nil, err
+			}
+			g.sizes[node.Name] = size
+			g.Nodes = append(g.Nodes, node)
+		}
+		if len(left) == len(pending) {
+			names := []string{}
+			for _, node := range left {
+				names = append(names, "`"+node.Name+"`")
+			}
+			return nil, fmt.Errorf("graph: %w: cycle between nodes %s", ErrInvalidGraph, strings.Join(names, ", "))
+		}
+		pending = left
+	}
+
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("graph: %w: no outputs", ErrInvalidGraph)
+	}
+	for _, output := range outputs {
+		if !declared[output] {
+			return nil, fmt.Errorf("graph: %w: unknown output `%s`", ErrInvalidGraph, output)
+		}
+	}
+	return g, nil
+}
+
+// declare records `name`, erroring if it is empty or already taken
+func (g *Graph) declare(declared map[string]bool, name string) error {
+	if name == "" {
+		return fmt.Errorf("graph: %w: missing name", ErrInvalidGraph)
+	} else if declared[name] {
+		return fmt.Errorf("graph: %w: duplicate name `%s`", ErrInvalidGraph, name)
+	}
+	declared[name] = true
+	return nil
+}
+
+// nodeSize returns the number of outputs of `node`, whose inputs are all sized
+func (g *Graph) nodeSize(node GraphNode) (int, error) {
+	merged := 0
+	for i, from := range node.From {
+		size := g.sizes[from]
+		if node.Merge == MergeConcat {
+			merged += size
+		} else if i == 0 {
+			merged = size
+		} else if size != merged {
+			return 0, fmt.Errorf("graph: %w: node `%s` adds `%s` of size %d to size %d", ErrInvalidGraph, node.Name, from, size, merged)
+		}
+	}
+
+	size := merged
+	if sized, ok := node.Module.(Sized); ok {
+		if in := sized.InputSize(); in >= 0 && in != merged {
+			return 0, fmt.Errorf("graph: %w: node `%s` wants %d inputs, got %d", ErrInvalidGraph, node.Name, in, merged)
+		}
+		if out := sized.OutputSize(); out >= 0 {
+			size = out
+		}
+	}
+	if node.Residual && size != merged {
+		return 0, fmt.Errorf("graph: %w: residual node `%s` gives %d outputs for %d inputs", ErrInvalidGraph, node.Name, size, merged)
+	}
+	return size, nil
+}
+
+// GraphBuilder declares a graph step by step, see NewGraphBuilder
+type GraphBuilder struct {
+	label   string
+	inputs  []GraphInput
+	nodes   []GraphNode
+	outputs []string
+}
+
+// NewGraphBuilder starts a graph, e.g. a residual block:
+//
+//	NewGraphBuilder("resnet").
+//		Input("x", 4).
+//		Node("h", NewLayer("h", 4, 8, WithActivation("relu")), "x").
+//		Residual("block", NewLayer("block", 8, 8, WithActivation("relu")), "h").
+//		Node("y", NewLayer("y", 8, 1), "block").
+//		Output("y").
+//		Build()
+func NewGraphBuilder(label string) *GraphBuilder {
+	return &GraphBuilder{label: label}
+}
+
+// Input adds an input taking `size` values
+func (b *GraphBuilder) Input(name string, size int) *GraphBuilder {
+	b.inputs = append(b.inputs, GraphInput{Name: name, Size: size})
+	return b
+}
+
+// Node adds a node applying `m` to the outputs of `from` concatenated
+func (b *GraphBuilder) Node(name string, m Module, from ...string) *GraphBuilder {
+	b.nodes = append(b.nodes, GraphNode{Name: name, Module: m, From: from, Merge: MergeConcat})
+	return b
+}
+
+// Residual adds a node applying `m` to the outputs of `from` concatenated, plus these outputs
+func (b *GraphBuilder) Residual(name string, m Module, from ...string) *GraphBuilder {
+	b.nodes = append(b.nodes, GraphNode{Name: name, Module: m, From: from, Merge: MergeConcat, Residual: true})
+	return b
+}
+
+// Concat adds a node concatenating the outputs of `from`
+func (b *GraphBuilder) Concat(name string, from ...string) *GraphBuilder {
+	return b.Node(name, nil, from...)
+}
+
+// Add adds a node summing the outputs of `from` value by value
+func (b *GraphBuilder) Add(name string, from ...string) *GraphBuilder {
+	b.nodes = append(b.nodes, GraphNode{Name: name, From: from, Merge: MergeAdd})
+	return b
+}
+
+// Output sets the inputs and nodes giving the outputs of the graph, in order
+func (b *GraphBuilder) Output(names ...string) *GraphBuilder {
+	b.outputs = append(b.outputs, names...)
+	return b
+}
+
+// Build validates the graph, see NewGraph
+func (b *GraphBuilder) Build() (*Graph, error) {
+	return NewGraph(b.label, b.inputs, b.nodes, b.outputs)
+}
+
+// Forwards returns the outputs of the graph for the single row `in`, see ForwardsBatch
+func (g *Graph) Forwards(in []*exptree.Node) []*exptree.Node {
+	return g.ForwardsBatch([][]*exptree.Node{in})[0]
+}
+
+// ForwardsBatch returns the outputs of the graph for each row of `in`.
+// BatchModule modules see the whole batch at once, the others each row in turn.
+func (g *Graph) ForwardsBatch(in [][]*exptree.Node) [][]*exptree.Node {
+	values := map[string][][]*exptree.Node{}
+	offset := 0
+	for _, input := range g.Inputs {
+		rows := [][]*exptree.Node{}
+		for _, row := range in {
+			g.checkInputs(len(row))
+			rows = append(rows, row[offset:offset+input.Size])
+		}
+		values[input.Name], offset = rows, offset+input.Size
+	}
+
+	for _, node := range g.Nodes {
+		merged := make([][]*exptree.Node, len(in))
+		for r := range in {
+			parts := [][]*exptree.Node{}
+			for _, from := range node.From {
+				parts = append(parts, values[from][r])
+			}
+			merged[r] = mergeNodes(fmt.Sprintf("%s_%s", g.Label, node.Name), node.Merge, parts)
+		}
+		out := merged
+		if node.Module != nil {
+			out = forwardsBatch(node.Module, merged)
+		}
+		if node.Residual {
+			for r := range out {
+				out[r] = mergeNodes(fmt.Sprintf("%s_%s_residual", g.Label, node.Name), MergeAdd, [][]*exptree.Node{out[r], merged[r]})
+			}
+		}
+		values[node.Name] = out
+	}
+
+	outputs := make([][]*exptree.Node, len(in))
+	for r := range in {
+		parts := [][]*exptree.Node{}
+		for _, name := range g.Outputs {
+			parts = append(parts, values[name][r])
+		}
+		outputs[r] = mergeNodes(g.Label, MergeConcat, parts)
+	}
+	return outputs
+}
+
+// ForwardsTensor returns the outputs of the graph for a whole batch `in` of shape [batch, inputs].
+// Panics if a module is not a TensorModule.
+func (g *Graph) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	g.checkInputs(in.Shape[len(in.Shape)-1])
+	values := map[string]*exptree.Tensor{}
+	offset := 0
+	for _, input := range g.Inputs {
+		values[input.Name] = exptree.Slice(fmt.Sprintf("%s_%s", g.Label, input.Name), in, -1, offset, offset+input.Size)
+		offset += input.Size
+	}
+
+	for _, node := range g.Nodes {
+		parts := []*exptree.Tensor{}
+		for _, from := range node.From {
+			parts = append(parts, values[from])
+		}
+		merged := mergeTensors(fmt.Sprintf("%s_%s", g.Label, node.Name), node.Merge, parts)
+		out := merged
+		if node.Module != nil {
+			out = forwardsTensor(node.Module, merged)
+		}
+		if node.Residual {
+			out = exptree.TensorAdd(fmt.Sprintf("%s_%s_residual", g.Label, node.Name), out, merged)
+		}
+		values[node.Name] = out
+	}
+
+	parts := []*exptree.Tensor{}
+	for _, name := range g.Outputs {
+		parts = append(parts, values[name])
+	}
+	return mergeTensors(g.Label, MergeConcat, parts)
+}
+
+// Predict computes the outputs of the graph for `in`, as in inference mode, without building an expression tree
+// for the modules that are Predictor. The outputs are a new slice, even when an output of the graph is one of its inputs.
+func (g *Graph) Predict(in []float64) []float64 {
+	g.checkInputs(len(in))
+	values := map[string][]float64{}
+	offset := 0
+	for _, input := range g.Inputs {
+		values[input.Name], offset = in[offset:offset+input.Size], offset+input.Size
+	}
+
+	for _, node := range g.Nodes {
+		parts := [][]float64{}
+		for _, from := range node.From {
+			parts = append(parts, values[from])
+		}
+		merged := mergeValues(node.Merge, parts)
+		out := merged
+		if node.Module != nil {
+			out = predict(node.Module, merged)
+		}
+		if node.Residual {
+			out = mergeValues(MergeAdd, [][]float64{out, merged})
+		}
+		values[node.Name] = out
+	}
+
+	parts := [][]float64{}
+	for _, name := range g.Outputs {
+		parts = append(parts, values[name])
+	}
+	return mergeValues(MergeConcat, parts)
+}
+
+// PredictBatch computes the outputs for each row of `inputs`, see Predict
+func (g *Graph) PredictBatch(inputs [][]float64) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+	for i := range inputs {
+		outputs[i] = g.Predict(inputs[i])
+	}
+	return outputs
+}
+
+// checkInputs panics if the graph does not take `size` inputs
+func (g *Graph) checkInputs(size int) {
+	if size != g.InputSize() {
+		panic(fmt.Sprintf("mismatch in graph `%s` inputs: want %d, got %d", g.Label, g.InputSize(), size))
+	}
+}
+
+// JoinInputs concatenates the values of each input of the graph, by name, into the inputs of the graph.
+// Panics if an input is missing or has the wrong size.
+func (g *Graph) JoinInputs(in map[string][]float64) []float64 {
+	joined := []float64{}
+	for _, input := range g.Inputs {
+		values, ok := in[input.Name]
+		if !ok || len(values) != input.Size {
+			panic(fmt.Sprintf("mismatch in graph `%s` input `%s`: want %d values, got %d", g.Label, input.Name, input.Size, len(values)))
+		}
+		joined = append(joined, values...)
+	}
+	return joined
+}
+
+// SplitOutputs splits the outputs of the graph by the name of the input or node giving them.
+// Panics if `out` does not hold as many values as the graph gives.
+func (g *Graph) SplitOutputs(out []float64) map[string][]float64 {
+	if len(out) != g.OutputSize() {
+		panic(fmt.Sprintf("mismatch in graph `%s` outputs: want %d, got %d", g.Label, g.OutputSize(), len(out)))
+	}
+	split := map[string][]float64{}
+	offset := 0
+	for _, name := range g.Outputs {
+		size := g.sizes[name]
+		split[name], offset = out[offset:offset+size], offset+size
+	}
+	return split
+}
+
+// Parameters returns the parameters of all nodes in order, every trainable node appearing exactly once
+func (g *Graph) Parameters() []*Parameter {
+	params := []*Parameter{}
+	for _, node := range g.Nodes {
+		if node.Module != nil {
+			params = append(params, node.Module.Parameters()...)
+		}
+	}
+	return uniqueParameters(params)
+}
+
+// ZeroGradient sets the gradients of all parameters to 0
+func (g *Graph) ZeroGradient() {
+	zeroGradient(g.Parameters())
+}
+
+// SetTraining switches all modules to training mode or to inference mode.
+// A new graph is in inference mode; Train switches to training mode for its duration.
+func (g *Graph) SetTraining(training bool) {
+	g.training = training
+	for _, node := range g.Nodes {
+		if node.Module != nil {
+			setTraining(node.Module, training)
+		}
+	}
+}
+
+// Training returns whether the graph is in training mode, see SetTraining
+func (g *Graph) Training() bool {
+	return g.training
+}
+
+// InputSize returns the total size of the inputs
+func (g *Graph) InputSize() int {
+	size := 0
+	for _, input := range g.Inputs {
+		size += input.Size
+	}
+	return size
+}
+
+// OutputSize returns the total size of the outputs
+func (g *Graph) OutputSize() int {
+	size := 0
+	for _, name := range g.Outputs {
+		size += g.sizes[name]
+	}
+	return size
+}
+
+func (g *Graph) ToJSONMap() map[string]any {
+	inputs := []map[string]any{}
+	for _, input := range g.Inputs {
+		inputs = append(inputs, map[string]any{"name": input.Name, "size": input.Size})
+	}
+	nodes := []map[string]any{}
+	for _, node := range g.Nodes {
+		var module map[string]any
+		if node.Module != nil {
+			module = node.Module.ToJSONMap()
+		}
+		nodes = append(nodes, map[string]any{
+			"name":     node.Name,
+			"module":   module,
+			"from":     node.From,
+			"merge":    node.Merge,
+			"residual": node.Residual,
+		})
+	}
+	return map[string]any{
+		"type":    ModuleGraph,
+		"name":    g.Label,
+		"inputs":  inputs,
+		"nodes":   nodes,
+		"outputs": g.Outputs,
+	}
+}
+
+// Train runs the training of all modules together, see MultiLayerPerceptron.Train for the options.
+// The rows of `trainX` and `trainY` are the inputs and outputs of the graph, see JoinInputs.
+func (g *Graph) Train(cycles int, learnrate float64, trainX [][]float64, trainY [][]float64, opts ...TrainOption) (*TrainingHistory, error) {
+	return train(&trainee{Module: g, label: g.Label}, cycles, learnrate, trainX, trainY, opts...)
+}
+
+// mergeNodes combines `parts` by `merge` into a new slice, summing them with nodes labelled after `label`
+func mergeNodes(label string, merge string, parts [][]*exptree.Node) []*exptree.Node {
+	if len(parts) == 1 {
+		return append([]*exptree.Node{}, parts[0]...)
+	} else if merge == MergeConcat {
+		merged := []*exptree.Node{}
+		for _, part := range parts {
+			merged = append(merged, part...)
+		}
+		return merged
+	}
+	merged := []*exptree.Node{}
+	for i := range parts[0] {
+		terms := []*exptree.Node{}
+		for _, part := range parts {
+			terms = append(terms, part[i])
+		}
+		merged = append(merged, exptree.Add(fmt.Sprintf("%s_add%d", label, i), terms...))
+	}
+	return merged
+}
+
+// mergeTensors combines `parts`, of shape [batch, size], by `merge`
+func mergeTensors(label string, merge string, parts []*exptree.Tensor) *exptree.Tensor {
+	if len(parts) == 1 {
+		return parts[0]
+	} else if merge == MergeConcat {
+		return exptree.Concat(label+"_concat", -1, parts...)
+	}
+	merged := parts[0]
+	for i, part := range parts[1:] {
+		merged = exptree.TensorAdd(fmt.Sprintf("%s_add%d", label, i), merged, part)
+	}
+	return merged
+}
+
+// mergeValues combines `parts` by `merge` into a new slice, so the values returned never alias those given
+func mergeValues(merge string, parts [][]float64) []float64 {
+	if len(parts) == 1 {
+		return append([]float64{}, parts[0]...)
+	}
+	merged := []float64{}
+	if merge == MergeConcat {
+		for _, part := range parts {
+			merged = append(merged, part...)
+		}
+		return merged
+	}
+	merged = append(merged, parts[0]...)
+	for _, part := range parts[1:] {
+		for i, x := range part {
+			merged[i] += x
+		}
+	}
+	return merged
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"nn/network/exptree"
+	"strings"
+	"testing"
+)
+
+func TestNewGraphInvalid(t *testing.T) {
+	x := []GraphInput{{Name: "x", Size: 2}}
+	tests := []struct {
+		name    string
+		inputs  []GraphInput
+		nodes   []GraphNode
+		outputs []string
+		message string // part of the error
+	}{
+		{"cycle", x, []GraphNode{{Name: "a", From: []string{"x", "b"}}, {Name: "b", From: []string{"a"}}}, []string{"b"},
+			"cycle between nodes `a`, `b`"},
+		{"self loop", x, []GraphNode{{Name: "a", From: []string{"a"}}}, []string{"a"}, "cycle between nodes `a`"},
+		{"missing input", x, []GraphNode{{Name: "a", From: []string{"y"}}}, []string{"a"}, "takes unknown `y`"},
+		{"takes nothing", x, []GraphNode{{Name: "a"}}, []string{"a"}, "takes nothing"},
+		{"duplicate node", x, []GraphNode{{Name: "a", From: []string{"x"}}, {Name: "a", From: []string{"x"}}}, []string{"a"},
+			"duplicate name `a`"},
+		{"node named as an input", x, []GraphNode{{Name: "x", From: []string{"x"}}}, []string{"x"}, "duplicate name `x`"},
+		{"duplicate input", []GraphInput{{Name: "x", Size: 1}, {Name: "x", Size: 1}}, nil, []string{"x"}, "duplicate name `x`"},
+		{"missing name", x, []GraphNode{{From: []string{"x"}}}, []string{"x"}, "missing name"},
+		{"no inputs", nil, nil, []string{"x"}, "no inputs"},
+		{"empty input", []GraphInput{{Name: "x"}}, nil, []string{"x"}, "input `x` has size 0"},
+		{"no outputs", x, nil, nil, "no outputs"},
+		{"unknown output", x, nil, []string{"y"}, "unknown output `y`"},
+		{"unknown merge", x, []GraphNode{{Name: "a", From: []string{"x"}, Merge: "mul"}}, []string{"a"}, "unknown merge `mul`"},
+		{"adding sizes", []GraphInput{{Name: "x", Size: 2}, {Name: "y", Size: 3}},
+			[]GraphNode{{Name: "a", From: []string{"x", "y"}, Merge: MergeAdd}}, []string{"a"}, "adds `y` of size 3 to size 2"},
+		{"module inputs", x, []GraphNode{{Name: "a", Module: NewLayer("a", 3, 1), From: []string{"x"}}}, []string{"a"},
+			"wants 3 inputs, got 2"},
+		{"residual sizes", x, []GraphNode{{Name: "a", Module: NewLayer("a", 2, 3), From: []string{"x"}, Residual: true}}, []string{"a"},
+			"gives 3 outputs for 2 inputs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewGraph("g", test.inputs, test.nodes, test.outputs)
+			if !errors.Is(err, ErrInvalidGraph) {
+				t.Fatalf("error %v, want ErrInvalidGraph", err)
+			} else if !strings.Contains(err.Error(), test.message) {
+				t.Fatalf("error %q does not tell %q", err, test.message)
+			}
+		})
+	}
+}
+
+func TestGraphSortsNodes(t *testing.T) {
+	g, err := NewGraph("g", []GraphInput{{Name: "x", Size: 1}}, []GraphNode{
+		{Name: "c", From: []string{"b", "a"}},
+		{Name: "b", From: []string{"a"}},
+		{Name: "a", From: []string{"x"}},
+		{Name: "d", From: []string{"x"}},
+	}, []string{"c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := []string{}
+	for _, node := range g.Nodes {
+		order = append(order, node.Name)
+	}
+	// nodes ready together keep the order they were declared in
+	if got := strings.Join(order, " "); got != "a d b c" {
+		t.Fatalf("nodes computed in the order %s, want a d b c", got)
+	}
+	if g.OutputSize() != 2 {
+		t.Fatalf("gives %d outputs, want 2", g.OutputSize())
+	}
+}
+
+// skipGraph feeds two inputs through a layer and a residual layer, giving the output of a last layer along with the
+// first input
+func skipGraph() (g *Graph, h, block, y *Layer) {
+	rng := rand.New(NewSource(8))
+	h = NewLayer("h", 3, 4, WithRand(rng))
+	block = NewLayer("block", 4, 4, WithRand(rng), WithActivation(ActivationReLU))
+	y = NewLayer("y", 4, 1, WithRand(rng))
+	g, err := NewGraphBuilder("g").
+		Input("a", 2).
+		Input("b", 1).
+		Node("h", h, "a", "b").
+		Residual("block", block, "h").
+		Node("y", y, "block").
+		Output("y", "a").
+		Build()
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func TestGraphSkipConnection(t *testing.T) {
+	g, h, block, y := skipGraph()
+	in := g.JoinInputs(map[string][]float64{"a": {0.5, -1}, "b": {2}})
+
+	hidden := h.Predict(in)
+	residual := block.Predict(hidden)
+	for i := range residual {
+		residual[i] += hidden[i]
+	}
+	want := append(y.Predict(residual), 0.5, -1)
+
+	nodes := []*exptree.Node{}
+	for i, x := range in {
+		nodes = append(nodes, exptree.NewConstant(fmt.Sprintf("in%d", i), x))
+	}
+	tensor := g.ForwardsTensor(exptree.TensorFromRows("in", [][]float64{in}))
+	for name, got := range map[string][]float64{
+		"Forwards":       nodesData(g.Forwards(nodes)),
+		"ForwardsTensor": tensor.Data,
+		"Predict":        g.Predict(in),
+	} {
+		for i := range want {
+			if len(got) != len(want) || math.Abs(got[i]-want[i]) > 1e-12 {
+				t.Fatalf("%s computes %v, want %v", name, got, want)
+			}
+		}
+	}
+
+	split := g.SplitOutputs(want)
+	if len(split["y"]) != 1 || split["a"][1] != -1 {
+		t.Fatalf("split the outputs into %v", split)
+	}
+}
+
+func TestGraphPredictCopies(t *testing.T) {
+	// the inputs are given back as they are, through a node passing them through and as an output of the graph
+	g, err := NewGraphBuilder("g").Input("x", 2).Concat("copy", "x").Output("copy").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := NewGraphBuilder("g").Input("x", 2).Output("x").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, g := range []*Graph{g, direct} {
+		in := []float64{1, 2}
+		out := g.Predict(in)
+		out[0] = 5
+		if in[0] != 1 {
+			t.Fatal("writing to the outputs changed the inputs")
+		}
+		in[1] = 7
+		if out[1] != 2 {
+			t.Fatal("writing to the inputs changed the outputs")
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package network
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Initializer draws the initial values of the weights of a layer
+type Initializer interface {
+	// Initialize returns `fanOut` rows of `fanIn` values each, row i holding the weights of neuron i
+	Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64
+}
+
+// fill builds a fanOut x fanIn matrix with values drawn from `draw`
+func fill(fanIn, fanOut int, draw func() float64) [][]float64 {
+	rows := make([][]float64, fanOut)
+	for i := range rows {
+		rows[i] = make([]float64, fanIn)
+		for j := range rows[i] {
+			rows[i][j] = draw()
+		}
+	}
+	return rows
+}
+
+// uniform draws from U(-limit, limit)
+func uniform(fanIn, fanOut int, rng *rand.Rand, limit float64) [][]float64 {
+	return fill(fanIn, fanOut, func() float64 { return (2*rng.Float64() - 1) * limit })
+}
+
+// normal draws from N(0, std^2)
+func normal(fanIn, fanOut int, rng *rand.Rand, std float64) [][]float64 {
+	return fill(fanIn, fanOut, func() float64 { return rng.NormFloat64() * std })
+}
+
+// XavierUniform (Glorot) draws from U(-sqrt(6 / (fanIn + fanOut)), sqrt(6 / (fanIn + fanOut))). Suits tanh and sigmoid.
+type XavierUniform struct{}
+
+func (XavierUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return uniform(fanIn, fanOut, rng, math.Sqrt(6/float64(fanIn+fanOut)))
+}
+
+// XavierNormal (Glorot) draws from N(0, 2 / (fanIn + fanOut))
+type XavierNormal struct{}
+
+func (XavierNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return normal(fanIn, fanOut, rng, math.Sqrt(2/float64(fanIn+fanOut)))
+}
+
+// HeUniform (Kaiming) draws from U(-sqrt(6 / fanIn), sqrt(6 / fanIn)). Suits ReLU and its variants.
+type HeUniform struct{}
+
+func (HeUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return uniform(fanIn, fanOut, rng, math.Sqrt(6/float64(fanIn)))
+}
+
+// HeNormal (Kaiming) draws from N(0, 2 / fanIn)
+type HeNormal struct{}
+
+func (HeNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return normal(fanIn, fanOut, rng, math.Sqrt(2/float64(fanIn)))
+}
+
+// LeCunUniform draws from U(-sqrt(3 / fanIn), sqrt(3 / fanIn))
+type LeCunUniform struct{}
+
+func (LeCunUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return uniform(fanIn, fanOut, rng, math.Sqrt(3/float64(fanIn)))
+}
+
+// LeCunNormal draws from N(0, 1 / fanIn)
+type LeCunNormal struct{}
+
+func (LeCunNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return normal(fanIn, fanOut, rng, math.Sqrt(1/float64(fanIn)))
+}
+
+// Orthogonal draws a random matrix with orthonormal rows, or orthonormal columns when there are more rows than columns,
+// scaled by `Gain` (1 if zero)
+type Orthogonal struct {
+	Gain float64
+}
+
+func (o Orthogonal) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	gain := o.Gain
+	if gain == 0 {
+		gain = 1
+	}
+
+	if fanOut <= fanIn {
+		return scale(orthonormalize(normal(fanIn, fanOut, rng, 1)), gain)
+	}
+
+	columns := orthonormalize(normal(fanOut, fanIn, rng, 1))
+	rows := make([][]float64, fanOut)
+	for i := range rows {
+		rows[i] = make([]float64, fanIn)
+		for j := range rows[i] {
+			rows[i][j] = columns[j][i]
+		}
+	}
+	return scale(rows, gain)
+}
+
+// orthonormalize runs gram-schmidt over `vectors` in place, which must be no more than their length
+func orthonormalize(vectors [][]float64) [][]float64 {
+	for i := range vectors {
+		for j := 0; j < i; j++ {
+			dot := 0.0
+			for k := range vectors[i] {
+				dot += vectors[i][k] * vectors[j][k]
+			}
+			for k := range vectors[i] {
+				vectors[i][k] -= dot * vectors[j][k]
+			}
+		}
+		norm := 0.0
+		for k := range vectors[i] {
+			norm += vectors[i][k] * vectors[i][k]
+		}
+		norm = math.Sqrt(norm)
+		for k := range vectors[i] {
+			if norm > 0 {
+				vectors[i][k] /= norm
+			}
+		}
+	}
+	return vectors
+}
+
+func scale(rows [][]float64, factor float64) [][]float64 {
+	for i := range rows {
+		for j := range rows[i] {
+			rows[i][j] *= factor
+		}
+	}
+	return rows
+}
+
+// Zeros sets every value to 0. The default for biases.
+type Zeros struct{}
+
+func (Zeros) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return fill(fanIn, fanOut, func() float64 { return 0 })
+}
+
+// Constant sets every value to `Value`
+type Constant struct {
+	Value float64
+}
+
+func (c Constant) Initialize(fanIn, fanOut int, rng *rand.Rand) [][]float64 {
+	return fill(fanIn, fanOut, func() float64 { return c.Value })
+}
@@ -0,0 +1,162 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var initializers = []Initializer{
+	XavierUniform{}, XavierNormal{}, HeUniform{}, HeNormal{}, LeCunUniform{}, LeCunNormal{}, Orthogonal{}, Orthogonal{Gain: 2},
+}
+
+func TestInitializersSeeded(t *testing.T) {
+	for _, initializer := range initializers {
+		t.Run(fmt.Sprintf("%T%v", initializer, initializer), func(t *testing.T) {
+			first := initializer.Initialize(5, 3, rand.New(NewSource(1)))
+			again := initializer.Initialize(5, 3, rand.New(NewSource(1)))
+			other := initializer.Initialize(5, 3, rand.New(NewSource(2)))
+			if len(first) != 3 || len(first[0]) != 5 {
+				t.Fatalf("drew %dx%d values, want 3 rows of 5", len(first), len(first[0]))
+			}
+			for i := range first {
+				if !equalFloats(first[i], again[i]) {
+					t.Fatalf("row %d is %v then %v with the same seed", i, first[i], again[i])
+				}
+				if equalFloats(first[i], other[i]) {
+					t.Fatalf("row %d is %v with two seeds", i, first[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInitializersVariance(t *testing.T) {
+	const fanIn, fanOut = 300, 200
+	tests := []struct {
+		initializer Initializer
+		variance    float64
+		limit       float64 // bound of the values of uniform initializers, 0 for normal ones
+	}{
+		{XavierUniform{}, 2.0 / (fanIn + fanOut), math.Sqrt(6.0 / (fanIn + fanOut))},
+		{XavierNormal{}, 2.0 / (fanIn + fanOut), 0},
+		{HeUniform{}, 2.0 / fanIn, math.Sqrt(6.0 / fanIn)},
+		{HeNormal{}, 2.0 / fanIn, 0},
+		{LeCunUniform{}, 1.0 / fanIn, math.Sqrt(3.0 / fanIn)},
+		{LeCunNormal{}, 1.0 / fanIn, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T", test.initializer), func(t *testing.T) {
+			sum, squares := 0.0, 0.0
+			for _, row := range test.initializer.Initialize(fanIn, fanOut, rand.New(NewSource(3))) {
+				for _, w := range row {
+					if test.limit > 0 && math.Abs(w) > test.limit {
+						t.Fatalf("drew %g, out of [-%g, %g]", w, test.limit, test.limit)
+					}
+					sum, squares = sum+w, squares+w*w
+				}
+			}
+			n := float64(fanIn * fanOut)
+			mean := sum / n
+			// 60000 draws put the sample mean within a few hundredths of a standard deviation and the variance within a few percent
+			if math.Abs(mean) > 0.02*math.Sqrt(test.variance) {
+				t.Fatalf("mean %g, want 0", mean)
+			}
+			if variance := squares/n - mean*mean; math.Abs(variance-test.variance) > 0.03*test.variance {
+				t.Fatalf("variance %g, want %g", variance, test.variance)
+			}
+		})
+	}
+}
+
+func TestOrthogonal(t *testing.T) {
+	for _, shape := range [][2]int{{6, 4}, {4, 6}} {
+		fanIn, fanOut := shape[0], shape[1]
+		rows := Orthogonal{Gain: 2}.Initialize(fanIn, fanOut, rand.New(NewSource(4)))
+		// the rows are orthogonal when there are fewer than inputs, the columns otherwise, each of norm Gain
+		vectors, size := rows, fanIn
+		if fanOut > fanIn {
+			vectors, size = make([][]float64, fanIn), fanOut
+			for j := range vectors {
+				for i := range rows {
+					vectors[j] = append(vectors[j], rows[i][j])
+				}
+			}
+		}
+		for i := range vectors {
+			for j := range vectors {
+				dot := 0.0
+				for k := 0; k < size; k++ {
+					dot += vectors[i][k] * vectors[j][k]
+				}
+				want := 0.0
+				if i == j {
+					want = 4
+				}
+				if math.Abs(dot-want) > 1e-9 {
+					t.Fatalf("%dx%d: product of vectors %d and %d is %g, want %g", fanOut, fanIn, i, j, dot, want)
+				}
+			}
+		}
+	}
+}
+
+func TestConstantInitializers(t *testing.T) {
+	for _, test := range []struct {
+		initializer Initializer
+		want        float64
+	}{{Zeros{}, 0}, {Constant{Value: 0.3}, 0.3}} {
+		for _, row := range test.initializer.Initialize(4, 3, rand.New(NewSource(5))) {
+			for _, w := range row {
+				if w != test.want {
+					t.Fatalf("%T drew %g, want %g", test.initializer, w, test.want)
+				}
+			}
+		}
+	}
+}
+
+func TestWithRand(t *testing.T) {
+	build := func(seed int64, opts ...Option) *MultiLayerPerceptron {
+		return NewMultiLayerPerceptron("mlp", 3, []int{4, 2}, append(opts, WithRand(rand.New(NewSource(seed))))...)
+	}
+	first, again, other := build(1).Parameters(), build(1).Parameters(), build(2).Parameters()
+	differ := false
+	for i := range first {
+		if first[i].Data != again[i].Data {
+			t.Fatalf("parameter `%s` is %g then %g with the same seed", first[i].Name, first[i].Data, again[i].Data)
+		}
+		differ = differ || first[i].Data != other[i].Data
+		if first[i].Kind == ParameterBias && first[i].Data != 0 {
+			t.Fatalf("bias `%s` is %g, want 0 by default", first[i].Name, first[i].Data)
+		}
+	}
+	if !differ {
+		t.Fatal("two seeds built the same parameters")
+	}
+
+	for _, p := range build(1, WithInitializer(Constant{Value: 0.5}), WithBiasInitializer(Constant{Value: -1})).Parameters() {
+		if want := map[ParameterKind]float64{ParameterWeight: 0.5, ParameterBias: -1}[p.Kind]; p.Data != want {
+			t.Fatalf("%s `%s` is %g, want %g", p.Kind, p.Name, p.Data, want)
+		}
+	}
+}
+
+func TestDefaultSource(t *testing.T) {
+	// models built alike without WithRand differ, unless the shared source is reseeded in between
+	SeedDefault(DefaultSeed)
+	first := NewLayer("layer", 3, 2).Parameters()
+	second := NewLayer("layer", 3, 2).Parameters()
+	SeedDefault(DefaultSeed)
+	again := NewLayer("layer", 3, 2).Parameters()
+	if first[0].Data == second[0].Data {
+		t.Fatal("two layers built without WithRand got the same weights")
+	}
+	for i := range first {
+		if first[i].Data != again[i].Data {
+			t.Fatalf("parameter `%s` is %g then %g after reseeding", first[i].Name, first[i].Data, again[i].Data)
+		}
+	}
+}
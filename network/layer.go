@@ -16,13 +16,18 @@ type Layer struct {
 // NewLayer creates a new layer or set of neurons
 // `numInputs` specifies the number of inputs for each neuron i.e also the number of weights
 // `numOutputs` specifies the number of neurons this layer has
-func NewLayer(label string, numInputs, numOutputs int) *Layer {
+// `opts` pick the activation of the layer with WithActivation and how its weights are drawn with WithInitializer,
+// WithBiasInitializer and WithRand
+func NewLayer(label string, numInputs, numOutputs int, opts ...Option) *Layer {
+	options := newOptions(opts...)
+	activation := mustGetActivation(options.Activation)
+	weights, biases := options.initialize(numInputs, numOutputs)
 
 	neurons := []*Neuron{}
 
 	for i := 0; i < numOutputs; i++ {
 		neuronLabel := fmt.Sprintf("%s_n%d", label, i)
-		neurons = append(neurons, NewNeuron(neuronLabel, numInputs))
+		neurons = append(neurons, newNeuronFromValues(neuronLabel, weights[i], biases[i], activation))
 	}
 
 	return &Layer{
@@ -33,26 +38,115 @@ func NewLayer(label string, numInputs, numOutputs int) *Layer {
 	}
 }
 
-// Forwards computes the output of the layer.
-func (l *Layer) Forwards(in []*exptree.Node) (output []*exptree.Node) {
+// Forwards computes the output of the layer, see ForwardsBatch
+func (l *Layer) Forwards(in []*exptree.Node) []*exptree.Node {
+	return l.ForwardsBatch([][]*exptree.Node{in})[0]
+}
 
-	for _, neuron := range l.Neurons {
-		output = append(output, neuron.Forwards(in))
+// ForwardsBatch computes the output of the layer for each row of `in` as a single matmul, see ForwardsTensor.
+// The nodes returned are produced by a node standing for the whole matmul, see exptree.TensorNodes.
+// Layers whose activation cannot be applied to tensors build the nodes of each neuron instead.
+// Each row should have len `NumberInputs`, or will panic
+func (l *Layer) ForwardsBatch(in [][]*exptree.Node) (output [][]*exptree.Node) {
+	if _, err := l.tensorActivation(); err != nil || len(in) == 0 {
+		for _, row := range in {
+			out := []*exptree.Node{}
+			for _, neuron := range l.Neurons {
+				out = append(out, neuron.Forwards(row))
+			}
+			output = append(output, out)
+		}
+		return
+	}
+
+	inputs := []*exptree.Node{}
+	for _, row := range in {
+		if len(row) != l.NumberInputs {
+			panic(fmt.Sprintf("mismatch in input dimensions: want %d, got %d", l.NumberInputs, len(row)))
+		}
+		inputs = append(inputs, row...)
+	}
+	batch := exptree.TensorFromNodes(l.Label+"_input", []int{len(in), l.NumberInputs}, inputs)
+	nodes := exptree.TensorNodes(l.Label+"_output", l.ForwardsTensor(batch))
+	for i := range in {
+		output = append(output, nodes[i*l.NumberOutputs:(i+1)*l.NumberOutputs])
 	}
 	return
 }
 
-// Parameters returns the weights of all nodes in this layer as a flattened array
-func (l *Layer) Parameters() []*exptree.Node {
-	n := []*exptree.Node{}
+// ForwardsTensor computes the output of the layer for a whole batch `in` of shape [batch, NumberInputs] as a single matmul,
+// giving shape [batch, NumberOutputs]. The weights and biases are gathered into tensors whose gradients are passed back
+// to the nodes of the neurons by BackPropagateTensor, so the optimizers see them as usual, see exptree.TensorFromNodes.
+// All neurons must share an activation registered with RegisterElementwiseActivation, or will panic
+func (l *Layer) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	activation, err := l.tensorActivation()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	numIn, numOut := l.NumberInputs, l.NumberOutputs
+	weightNodes, biasNodes := make([]*exptree.Node, numIn*numOut), make([]*exptree.Node, numOut)
+	for j, neuron := range l.Neurons {
+		for i, w := range neuron.Weights {
+			weightNodes[i*numOut+j] = w
+		}
+		biasNodes[j] = neuron.Bias
+	}
+	weights := exptree.TensorFromNodes(l.Label+"_weights", []int{numIn, numOut}, weightNodes)
+	biases := exptree.TensorFromNodes(l.Label+"_biases", []int{numOut}, biasNodes)
+
+	product := exptree.MatMul(l.Label+"_product", in, weights)
+	biased := exptree.TensorAdd(l.Label+"_biased", product, biases)
+	return activation.Elementwise.Tensor(l.Label+"_output", biased)
+}
+
+// tensorActivation returns the activation shared by all neurons, if it can be applied to tensors
+func (l *Layer) tensorActivation() (*Activation, error) {
+	if len(l.Neurons) == 0 {
+		return nil, fmt.Errorf("layer `%s` has no neurons", l.Label)
+	}
+	activation := l.Neurons[0].Activation
+	for _, neuron := range l.Neurons {
+		if neuron.Activation != activation {
+			return nil, fmt.Errorf("layer `%s` mixes activations `%s` and `%s`", l.Label, activation.Name, neuron.Activation.Name)
+		}
+	}
+	if activation.Elementwise == nil {
+		return nil, fmt.Errorf("layer `%s` activation `%s` cannot be applied to tensors", l.Label, activation.Name)
+	}
+	return activation, nil
+}
+
+// Parameters returns the weights and biases of all neurons in this layer as a flattened array
+func (l *Layer) Parameters() []*Parameter {
+	params := []*Parameter{}
 	for i := range l.Neurons {
-		n = append(n, l.Neurons[i].Weights...)
+		for _, p := range l.Neurons[i].Parameters() {
+			p.Layer = l.Label
+			params = append(params, p)
+		}
 	}
-	return n
+	return uniqueParameters(params)
+}
+
+// ZeroGradient sets the gradients of the weights and biases of all neurons to 0
+func (l *Layer) ZeroGradient() {
+	zeroGradient(l.Parameters())
+}
+
+// InputSize returns the number of inputs of each neuron
+func (l *Layer) InputSize() int {
+	return l.NumberInputs
+}
+
+// OutputSize returns the number of neurons
+func (l *Layer) OutputSize() int {
+	return l.NumberOutputs
 }
 
 func (l *Layer) ToJSONMap() map[string]any {
 	data := map[string]any{
+		"type":           ModuleLayer,
 		"name":           l.Label,
 		"number_inputs":  l.NumberInputs,
 		"number_outputs": l.NumberOutputs,
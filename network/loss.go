@@ -0,0 +1,228 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+)
+
+// Reduction is how the losses of the samples of a batch are combined
+type Reduction int
+
+// ReduceMean averages the sample losses, ReduceSum adds them up
+const (
+	ReduceMean Reduction = iota
+	ReduceSum
+)
+
+// Loss measures how far the predictions of a network are from their targets.
+// Losses are built from exptree nodes, so BackPropagate works through them.
+type Loss interface {
+	// Sample builds the loss of a single prediction `pred` against its target `want`
+	Sample(label string, pred, want []*exptree.Node) *exptree.Node
+	// Reduction is how the sample losses of a batch are combined
+	Reduction() Reduction
+}
+
+// TensorLoss is implemented by losses that can also be computed over a whole batch as tensors, see WithVectorized
+type TensorLoss interface {
+	Loss
+	// Tensor builds the loss of `pred` against `want`, both of shape [batch, outputs], as a scalar tensor
+	Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor
+}
+
+// BatchLoss builds the loss of all rows of `pred` against `want`, combined as per the reduction of `loss`
+func BatchLoss(label string, loss Loss, pred, want [][]*exptree.Node) *exptree.Node {
+	samples := []*exptree.Node{}
+	for i := range pred {
+		samples = append(samples, loss.Sample(fmt.Sprintf("%s_r%d", label, i), pred[i], want[i]))
+	}
+	if loss.Reduction() == ReduceSum {
+		return exptree.Add(label, samples...)
+	}
+	return exptree.Mean(label, samples...)
+}
+
+// elementwise builds `fn` for each pair of prediction and target
+func elementwise(label string, pred, want []*exptree.Node, fn func(label string, p, w *exptree.Node) *exptree.Node) []*exptree.Node {
+	if len(pred) != len(want) {
+		panic(fmt.Sprintf("mismatch in loss dimensions: want %d, got %d", len(want), len(pred)))
+	}
+	out := []*exptree.Node{}
+	for j := range pred {
+		out = append(out, fn(fmt.Sprintf("%s_%d", label, j), pred[j], want[j]))
+	}
+	return out
+}
+
+// negate flips the sign of every value of `tensor`
+func negate(label string, tensor *exptree.Tensor) *exptree.Tensor {
+	return exptree.TensorUnary(label, exptree.OperationNegate, tensor,
+		func(x float64) float64 { return -x },
+		func(x, y float64) float64 { return -1 })
+}
+
+// MeanSquaredError is the mean of (predicted - wanted) ^ 2 over all outputs of all rows
+type MeanSquaredError struct{}
+
+func (MeanSquaredError) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.SquaredDifference(label, p, w)
+	})...)
+}
+
+func (MeanSquaredError) Reduction() Reduction { return ReduceMean }
+
+func (MeanSquaredError) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	diff := exptree.TensorSub(label+"_diff", pred, want)
+	return exptree.TensorMean(label, exptree.TensorMultiply(label+"_square", diff, diff))
+}
+
+// SumSquaredError is the sum of (predicted - wanted) ^ 2 over all outputs of all rows
+type SumSquaredError struct{}
+
+func (SumSquaredError) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Add(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.SquaredDifference(label, p, w)
+	})...)
+}
+
+func (SumSquaredError) Reduction() Reduction { return ReduceSum }
+
+func (SumSquaredError) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	diff := exptree.TensorSub(label+"_diff", pred, want)
+	return exptree.TensorSum(label, exptree.TensorMultiply(label+"_square", diff, diff))
+}
+
+// MeanAbsoluteError is the mean of |predicted - wanted| over all outputs of all rows
+type MeanAbsoluteError struct{}
+
+func (MeanAbsoluteError) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.Abs(label, exptree.Sub(label+"_diff", p, w))
+	})...)
+}
+
+func (MeanAbsoluteError) Reduction() Reduction { return ReduceMean }
+
+func (MeanAbsoluteError) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	diff := exptree.TensorSub(label+"_diff", pred, want)
+	return exptree.TensorMean(label, exptree.AbsFunc.Tensor(label+"_abs", diff))
+}
+
+// Huber is quadratic for errors up to `Delta` and linear past it, averaged over all outputs of all rows.
+// for d = predicted - wanted
+// 0.5 * d ^ 2 if |d| <= delta, else delta * (|d| - 0.5 * delta)
+type Huber struct {
+	Delta float64
+}
+
+func (h Huber) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.Huber(label, exptree.Sub(label+"_diff", p, w), h.Delta)
+	})...)
+}
+
+func (Huber) Reduction() Reduction { return ReduceMean }
+
+func (h Huber) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	diff := exptree.TensorSub(label+"_diff", pred, want)
+	return exptree.TensorMean(label, exptree.HuberFunc(h.Delta).Tensor(label+"_huber", diff))
+}
+
+// BinaryCrossEntropy expects predictions in (0, 1), e.g. from a sigmoid, and targets of 0 or 1.
+// -(wanted * ln(predicted) + (1 - wanted) * ln(1 - predicted)), averaged over all outputs of all rows.
+// `Epsilon` is added inside the logs to keep them finite, 1e-12 if zero.
+type BinaryCrossEntropy struct {
+	Epsilon float64
+}
+
+func (b BinaryCrossEntropy) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	epsilon := b.Epsilon
+	if epsilon == 0 {
+		epsilon = 1e-12
+	}
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		one := exptree.NewConstant(label+"_one", 1)
+		eps := exptree.NewConstant(label+"_eps", epsilon)
+		logp := exptree.Log(label+"_logp", exptree.Add(label+"_p", p, eps))
+		logq := exptree.Log(label+"_logq", exptree.Add(label+"_q", exptree.Sub(label+"_1mp", one, p), eps))
+		positive := exptree.Multiply(label+"_positive", w, logp)
+		negative := exptree.Multiply(label+"_negative", exptree.Sub(label+"_1mw", one, w), logq)
+		return exptree.Negate(label, exptree.Add(label+"_sum", positive, negative))
+	})...)
+}
+
+func (BinaryCrossEntropy) Reduction() Reduction { return ReduceMean }
+
+func (b BinaryCrossEntropy) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	epsilon := b.Epsilon
+	if epsilon == 0 {
+		epsilon = 1e-12
+	}
+	logp := exptree.TensorUnary(label+"_logp", exptree.OperationLog, pred,
+		func(x float64) float64 { return math.Log(x + epsilon) },
+		func(x, y float64) float64 { return 1 / (x + epsilon) })
+	logq := exptree.TensorUnary(label+"_logq", exptree.OperationLog, pred,
+		func(x float64) float64 { return math.Log(1 - x + epsilon) },
+		func(x, y float64) float64 { return -1 / (1 - x + epsilon) })
+	one := exptree.NewTensor(label+"_one", []int{}, []float64{1})
+	positive := exptree.TensorMultiply(label+"_positive", want, logp)
+	negative := exptree.TensorMultiply(label+"_negative", exptree.TensorSub(label+"_1mw", one, want), logq)
+	return negate(label, exptree.TensorMean(label+"_mean", exptree.TensorAdd(label+"_sum", positive, negative)))
+}
+
+// CategoricalCrossEntropy applies softmax to the predictions, taken as logits, and compares them against a target distribution,
+// usually one-hot. -sum(wanted * ln(softmax(predicted))), averaged over all rows.
+type CategoricalCrossEntropy struct{}
+
+func (CategoricalCrossEntropy) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	logp := exptree.LogSoftmax(label+"_logsoftmax", pred...)
+	terms := elementwise(label, logp, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.Multiply(label, w, p)
+	})
+	return exptree.Negate(label, exptree.Add(label+"_sum", terms...))
+}
+
+func (CategoricalCrossEntropy) Reduction() Reduction { return ReduceMean }
+
+func (CategoricalCrossEntropy) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	// the largest logit of each row is subtracted before exponentiating, as with exptree.LogSoftmax
+	rows := pred.Shape[0]
+	shift := exptree.Reshape(label+"_max", exptree.TensorMax(label+"_rowmax", pred, 1), rows, 1)
+	shifted := exptree.TensorSub(label+"_shifted", pred, shift)
+	exps := exptree.TensorUnary(label+"_exp", exptree.OperationExp, shifted, math.Exp, func(x, y float64) float64 { return y })
+	sums := exptree.Reshape(label+"_sumexp", exptree.TensorSum(label+"_rowsum", exps, 1), rows, 1)
+	logsum := exptree.TensorUnary(label+"_logsumexp", exptree.OperationLog, sums, math.Log, func(x, y float64) float64 { return 1 / x })
+	logp := exptree.TensorSub(label+"_logsoftmax", shifted, logsum)
+	terms := exptree.TensorSum(label+"_sum", exptree.TensorMultiply(label+"_terms", want, logp), 1)
+	return negate(label, exptree.TensorMean(label+"_mean", terms))
+}
+
+// Hinge expects targets of -1 or 1. max(0, 1 - wanted * predicted), averaged over all outputs of all rows.
+type Hinge struct{}
+
+func (Hinge) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		margin := exptree.Sub(label+"_margin", exptree.NewConstant(label+"_one", 1), exptree.Multiply(label+"_product", w, p))
+		return exptree.ReLU(label, margin)
+	})...)
+}
+
+func (Hinge) Reduction() Reduction { return ReduceMean }
+
+// LogCosh is ln(cosh(predicted - wanted)), averaged over all outputs of all rows
+type LogCosh struct{}
+
+func (LogCosh) Sample(label string, pred, want []*exptree.Node) *exptree.Node {
+	return exptree.Mean(label, elementwise(label, pred, want, func(label string, p, w *exptree.Node) *exptree.Node {
+		return exptree.LogCosh(label, exptree.Sub(label+"_diff", p, w))
+	})...)
+}
+
+func (LogCosh) Reduction() Reduction { return ReduceMean }
+
+func (LogCosh) Tensor(label string, pred, want *exptree.Tensor) *exptree.Tensor {
+	diff := exptree.TensorSub(label+"_diff", pred, want)
+	return exptree.TensorMean(label, exptree.LogCoshFunc.Tensor(label+"_logcosh", diff))
+}
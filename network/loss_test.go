@@ -0,0 +1,107 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+	"testing"
+)
+
+// lossCases are losses along with a batch of two predictions and targets they accept, and the loss of that batch
+var lossCases = []struct {
+	name       string
+	loss       Loss
+	pred, want [][]float64
+	value      float64
+}{
+	{"mse", MeanSquaredError{}, [][]float64{{0.5, -1}, {2, 0}}, [][]float64{{0, 1}, {1, 0}},
+		((0.25+4)/2 + 1.0/2) / 2},
+	{"sse", SumSquaredError{}, [][]float64{{0.5, -1}, {2, 0}}, [][]float64{{0, 1}, {1, 0}},
+		0.25 + 4 + 1},
+	{"mae", MeanAbsoluteError{}, [][]float64{{0.5, -1}, {2, 0}}, [][]float64{{0, 1}, {1, 0}},
+		((0.5+2)/2 + 1.0/2) / 2},
+	// both branches: 0.5 * 0.5^2 and 1 * (2 - 0.5), then 1 * (1 - 0.5) at the boundary
+	{"huber", Huber{Delta: 1}, [][]float64{{0.5, -1}, {2, 0}}, [][]float64{{0, 1}, {1, 0}},
+		((0.125+1.5)/2 + 0.5/2) / 2},
+	{"logcosh", LogCosh{}, [][]float64{{0.5, -1}, {2, 0}}, [][]float64{{0, 1}, {1, 0}},
+		((math.Log(math.Cosh(0.5))+math.Log(math.Cosh(2)))/2 + math.Log(math.Cosh(1))/2) / 2},
+	{"binary cross-entropy", BinaryCrossEntropy{}, [][]float64{{0.8, 0.3}, {0.6, 0.1}}, [][]float64{{1, 0}, {0, 1}},
+		(-(math.Log(0.8)+math.Log(0.7))/2 - (math.Log(0.4)+math.Log(0.1))/2) / 2},
+	{"categorical cross-entropy", CategoricalCrossEntropy{}, [][]float64{{1, 2, 3}, {0, 0, 0}}, [][]float64{{0, 0, 1}, {1, 0, 0}},
+		(-math.Log(math.Exp(3)/(math.Exp(1)+math.Exp(2)+math.Exp(3))) + math.Log(3)) / 2},
+	// margins 1 - (-1 * 0.5) and 1 - (1 * 2), the second clipped to zero
+	{"hinge", Hinge{}, [][]float64{{0.5, 2}, {-0.5, 0}}, [][]float64{{-1, 1}, {1, -1}},
+		((1.5+0)/2 + (1.5+1)/2) / 2},
+}
+
+// lossNodes builds the loss of `pred` against `want` over trainable predictions and constant targets
+func lossNodes(loss Loss, pred, want [][]float64) (*exptree.Node, [][]*exptree.Node) {
+	p, w := [][]*exptree.Node{}, [][]*exptree.Node{}
+	for i := range pred {
+		p, w = append(p, []*exptree.Node{}), append(w, []*exptree.Node{})
+		for j := range pred[i] {
+			p[i] = append(p[i], exptree.NewNode(fmt.Sprintf("p%d_%d", i, j), pred[i][j]))
+			w[i] = append(w[i], exptree.NewConstant(fmt.Sprintf("w%d_%d", i, j), want[i][j]))
+		}
+	}
+	return BatchLoss("loss", loss, p, w), p
+}
+
+func TestLosses(t *testing.T) {
+	for _, test := range lossCases {
+		t.Run(test.name, func(t *testing.T) {
+			root, _ := lossNodes(test.loss, test.pred, test.want)
+			if math.Abs(root.Data-test.value) > 1e-9 {
+				t.Fatalf("loss is %.12g, want %.12g", root.Data, test.value)
+			}
+			if report := exptree.GradCheck(root, 1e-6, 1e-6); !report.Passed {
+				t.Fatal(report)
+			}
+		})
+	}
+}
+
+func TestTensorLosses(t *testing.T) {
+	for _, test := range lossCases {
+		loss, ok := test.loss.(TensorLoss)
+		if !ok {
+			continue
+		}
+		t.Run(test.name, func(t *testing.T) {
+			root, nodes := lossNodes(test.loss, test.pred, test.want)
+			exptree.BackPropagate(root)
+
+			pred := exptree.TensorFromRows("pred", test.pred)
+			tensor := loss.Tensor("loss", pred, exptree.TensorFromRows("want", test.want))
+			exptree.BackPropagateTensor(tensor)
+			if math.Abs(tensor.Data[0]-test.value) > 1e-9 {
+				t.Fatalf("tensor loss is %.12g, want %.12g", tensor.Data[0], test.value)
+			}
+			for i := range nodes {
+				for j, node := range nodes[i] {
+					if got := pred.Gradient[i*len(nodes[i])+j]; math.Abs(got-node.Gradient) > 1e-9 {
+						t.Fatalf("tensor gradient of prediction %d,%d is %g, want %g", i, j, got, node.Gradient)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHuberBranchFollowsData(t *testing.T) {
+	// built in the quadratic branch, then moved to the linear one: the gradient must follow the new data
+	p := exptree.NewNode("p", 0.5)
+	loss := Huber{Delta: 1}.Sample("loss", []*exptree.Node{p}, []*exptree.Node{exptree.NewConstant("w", 0)})
+	plan := exptree.NewPlan(loss)
+
+	p.Data = -3
+	plan.Forward()
+	plan.ZeroGradient()
+	plan.BackPropagate()
+	if loss.Data != 2.5 {
+		t.Fatalf("loss is %g after moving the prediction, want 2.5", loss.Data)
+	}
+	if p.Gradient != -1 {
+		t.Fatalf("gradient is %g after moving the prediction, want -1", p.Gradient)
+	}
+}
@@ -7,10 +7,14 @@ import (
 
 // MultiLayerPerceptron is the simplest kind of neural network
 type MultiLayerPerceptron struct {
-	Label         string
-	Layers        []*Layer
-	NumberInputs  int
-	NumberOutputs []int
+	Label          string
+	Layers         []*Layer
+	Normalizations []Normalization // normalization applied to the output of each layer, before its dropout, by index. Missing or nil entries apply none
+	Dropouts       []*Dropout      // dropout applied to the output of each layer, by index. Missing or nil entries apply none
+	NumberInputs   int
+	NumberOutputs  []int
+
+	training bool
 }
 
 // NewMultiLayerPerceptron creates a new MLP. the num inputs is the number of inputs
@@ -18,23 +22,88 @@ type MultiLayerPerceptron struct {
 // the value of index in `numOut` specifies the number of neurons the corresponding layer will have
 // the value of index of the previous layer in `numOut` specifies the number of inputs each neuron will have
 // Basically, the way an MLP works is that all outputs of previous layer are feed to each neuron in the successive layer.
-func NewMultiLayerPerceptron(label string, numIn int, numOut []int) *MultiLayerPerceptron {
+// WithActivation sets the activation of all layers, WithLayerActivations sets it layer by layer.
+// All layers draw their weights from the source set with WithRand, so the same seed builds the same network.
+// WithNormalization inserts batch or layer normalization after layers, and panics on an unknown kind.
+// WithDropout inserts dropout after layers, its masks drawn from sources seeded from the same source.
+func NewMultiLayerPerceptron(label string, numIn int, numOut []int, opts ...Option) *MultiLayerPerceptron {
+	options := newOptions(opts...)
 	allLayers := append([]int{numIn}, numOut...)
 	layers := []*Layer{}
 	for i := 0; i < len(numOut); i++ {
 		layerLabel := fmt.Sprintf("l%d", i)
-		layers = append(layers, NewLayer(layerLabel, allLayers[i], allLayers[i+1]))
+		layers = append(layers, NewLayer(layerLabel, allLayers[i], allLayers[i+1], options.forLayer(i)))
+	}
+
+	var normalizations []Normalization
+	for i, kind := range options.Normalizations {
+		if i >= len(layers) || kind == "" {
+			continue
+		}
+		normalization, err := newNormalization(kind, fmt.Sprintf("l%d_%s", i, kind), numOut[i])
+		if err != nil {
+			panic(err.Error())
+		}
+		if normalizations == nil {
+			normalizations = make([]Normalization, len(layers))
+		}
+		normalizations[i] = normalization
 	}
+
+	var dropouts []*Dropout
+	for i, rate := range options.Dropout {
+		if i >= len(layers) || rate == 0 {
+			continue
+		}
+		if dropouts == nil {
+			dropouts = make([]*Dropout, len(layers))
+		}
+		dropouts[i] = newSeededDropout(fmt.Sprintf("l%d_dropout", i), rate, options.Rand.Int63())
+	}
+
 	return &MultiLayerPerceptron{
-		Label:         label,
-		Layers:        layers,
-		NumberInputs:  numIn,
-		NumberOutputs: numOut,
+		Label:          label,
+		Layers:         layers,
+		Normalizations: normalizations,
+		Dropouts:       dropouts,
+		NumberInputs:   numIn,
+		NumberOutputs:  numOut,
+	}
+}
+
+// SetTraining switches the mlp, its normalizations and its dropouts, to training mode or to inference mode.
+// A new mlp is in inference mode; Train switches to training mode for its duration.
+func (mlp *MultiLayerPerceptron) SetTraining(training bool) {
+	mlp.training = training
+	for _, m := range submodules(mlp) {
+		setTraining(m, training)
+	}
+}
+
+// Training returns whether the mlp is in training mode, see SetTraining
+func (mlp *MultiLayerPerceptron) Training() bool {
+	return mlp.training
+}
+
+// normalization returns the normalization after the layer at `index`, nil if there is none
+func (mlp *MultiLayerPerceptron) normalization(index int) Normalization {
+	if index < len(mlp.Normalizations) {
+		return mlp.Normalizations[index]
 	}
+	return nil
+}
+
+// dropout returns the dropout after the layer at `index`, nil if there is none
+func (mlp *MultiLayerPerceptron) dropout(index int) *Dropout {
+	if index < len(mlp.Dropouts) {
+		return mlp.Dropouts[index]
+	}
+	return nil
 }
 
 func (mlp *MultiLayerPerceptron) ToJSONMap() map[string]any {
 	data := map[string]any{
+		"type":             ModulePerceptron,
 		"name":             mlp.Label,
 		"layer_dimensions": append([]int{mlp.NumberInputs}, mlp.NumberOutputs...),
 		"layers":           map[string]any{},
@@ -45,90 +114,150 @@ func (mlp *MultiLayerPerceptron) ToJSONMap() map[string]any {
 		layers = append(layers, layer.ToJSONMap())
 	}
 	data["layers"] = layers
+
+	if len(mlp.Normalizations) > 0 {
+		normalizations := make([]any, len(mlp.Layers))
+		for i := range normalizations {
+			if normalization := mlp.normalization(i); normalization != nil {
+				normalizations[i] = normalization.ToJSONMap()
+			}
+		}
+		data["normalizations"] = normalizations
+	}
+	if len(mlp.Dropouts) > 0 {
+		rates, states := make([]float64, len(mlp.Layers)), make([]*uint64, len(mlp.Layers))
+		for i := range rates {
+			if dropout := mlp.dropout(i); dropout != nil {
+				rates[i], states[i] = dropout.Rate, dropout.sourceState()
+			}
+		}
+		data["dropout"], data["dropout_states"] = rates, states
+	}
 	return data
-	//fmt.Println(os.WriteFile(outfile, data, 0644))
 }
 
-// Forwards returns the final output of this neural network
-
+// Forwards returns the final output of this neural network.
+// It is ForwardsBatch for a single row, so batch normalization in training mode sees a batch of one.
 func (mlp *MultiLayerPerceptron) Forwards(in []*exptree.Node) (out []*exptree.Node) {
+	return mlp.ForwardsBatch([][]*exptree.Node{in})[0]
+}
+
+// ForwardsBatch returns the final output of this neural network for each row of `in`.
+// Rows go through the layers independently, except through batch normalization which, in training mode,
+// normalizes with the statistics of the whole batch.
+func (mlp *MultiLayerPerceptron) ForwardsBatch(in [][]*exptree.Node) (out [][]*exptree.Node) {
 	buf := in
 	for i := range mlp.Layers {
-		buf = mlp.Layers[i].Forwards(buf)
+		buf = mlp.Layers[i].ForwardsBatch(buf)
+
+		if normalization := mlp.normalization(i); normalization != nil {
+			buf = normalization.ForwardsBatch(buf)
+		}
+		if dropout := mlp.dropout(i); dropout != nil {
+			for r := range buf {
+				buf[r] = dropout.Forwards(buf[r])
+			}
+		}
 	}
 	return buf
 }
 
-// Parameters returns the weights of all nodes in all layers as a flattened array
-func (mlp *MultiLayerPerceptron) Parameters() []*exptree.Node {
-	n := []*exptree.Node{}
+// ForwardsTensor returns the final output of this neural network for a whole batch `in` of shape [batch, NumberInputs],
+// see Layer.ForwardsTensor
+func (mlp *MultiLayerPerceptron) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	buf := in
 	for i := range mlp.Layers {
-		n = append(n, mlp.Layers[i].Parameters()...)
+		buf = mlp.Layers[i].ForwardsTensor(buf)
+		if normalization := mlp.normalization(i); normalization != nil {
+			buf = normalization.ForwardsTensor(buf)
+		}
+		if dropout := mlp.dropout(i); dropout != nil {
+			buf = dropout.ForwardsTensor(buf)
+		}
 	}
-	return n
+	return buf
 }
 
-// ZeroGradient sets gradients for all nodes in this mlp to 0
-func (mlp *MultiLayerPerceptron) ZeroGradient() *MultiLayerPerceptron {
-	for _, n := range mlp.Parameters() {
-		n.Gradient = 0
+// Parameters returns the weights and biases of all neurons in all layers as a flattened array.
+// Every trainable node appears exactly once, in a stable order.
+func (mlp *MultiLayerPerceptron) Parameters() []*Parameter {
+	params := []*Parameter{}
+	for i := range mlp.Layers {
+		params = append(params, mlp.Layers[i].Parameters()...)
+		if normalization := mlp.normalization(i); normalization != nil {
+			params = append(params, normalization.Parameters()...)
+		}
 	}
-	return mlp
+	return uniqueParameters(params)
+}
+
+// ZeroGradient sets gradients for all nodes in this mlp to 0
+func (mlp *MultiLayerPerceptron) ZeroGradient() {
+	zeroGradient(mlp.Parameters())
+}
+
+// InputSize returns the number of inputs of the mlp
+func (mlp *MultiLayerPerceptron) InputSize() int {
+	return mlp.NumberInputs
+}
+
+// OutputSize returns the number of outputs of the last layer
+func (mlp *MultiLayerPerceptron) OutputSize() int {
+	return mlp.NumberOutputs[len(mlp.NumberOutputs)-1]
 }
 
 // Train runs the training, performing backpropagation and gradient descent.
-func (mlp *MultiLayerPerceptron) Train(cycles int, learnrate float64, trainX [][]float64, trainY [][]float64) error {
-
-	if len(trainX) <= 0 {
-		return fmt.Errorf("train: inputs must contain something")
-	} else if len(trainY) != len(trainX) {
-		return fmt.Errorf("train: mismatch b/w input and output, want %d got %d", len(trainX), len(trainY))
-	} else if len(trainX[0]) != mlp.NumberInputs {
-		return fmt.Errorf("train: mismatch b/w train set dimensions & mlp dimensions, want %d got %d", (mlp.NumberInputs), len(trainX[0]))
-	} else if len(trainY[0]) != mlp.NumberOutputs[len(mlp.NumberOutputs)-1] {
-		return fmt.Errorf("train: mismatch b/w train set dimensions & mlp dimensions, want %d got %d", (mlp.NumberOutputs[len(mlp.NumberOutputs)-1]), len(trainY[0]))
-	}
-
-	var (
-		trainx, trainy = toNodes(trainX, trainY)
-	)
-
-	for i := 0; i < cycles; i++ {
-		netloss := mlp.MeanSquaredLoss(trainx, trainy)
-		mlp.ZeroGradient()
-		exptree.BackPropagate(netloss)
-		fmt.Println(netloss)
-
-		for _, node := range mlp.Parameters() {
-			node.Data += -learnrate * node.Gradient
-		}
-	}
+// `learnrate` is the learning rate of plain gradient descent, used unless an optimizer is set with WithOptimizer, and the
+// initial learning rate of the scheduler set with WithScheduler. The learning rate stays fixed for all cycles without one.
+// The loss minimized is MeanSquaredError unless set with WithLoss.
+// Each cycle is an epoch over `trainX`, split in batches with WithBatchSize, WithShuffle and WithDropLast.
+// WithVectorized computes each batch with tensors rather than a node per scalar.
+// WithWorkers splits each batch across goroutines, each with its own copy of the network.
+// The gradients can be limited before each optimizer step with WithGradientClipping.
+// WithRegularization adds a penalty on the parameters to the loss, included in the reported losses.
+// A validation set can be given with WithValidation or WithValidationSplit, its loss is evaluated after each epoch.
+// WithEarlyStopping ends the training once the validation loss, or the training loss without a validation set, stops improving.
+// Progress is reported to the callbacks set with WithCallbacks, and summarized in the returned history.
+// The mlp is in training mode while computing gradients and in inference mode while evaluating the validation set,
+// and is left in the mode it was in before the call.
+func (mlp *MultiLayerPerceptron) Train(cycles int, learnrate float64, trainX [][]float64, trainY [][]float64, opts ...TrainOption) (*TrainingHistory, error) {
+	return train(&trainee{Module: mlp, label: mlp.Label}, cycles, learnrate, trainX, trainY, opts...)
+}
 
-	// Graph("graph.png", netLoss)
-	return nil
+// Loss builds the loss of the predictions of this mlp for each row in trainx against the same row in trainy
+func (mlp *MultiLayerPerceptron) Loss(loss Loss, trainx [][]*exptree.Node, trainy [][]*exptree.Node) *exptree.Node {
+	return (&trainee{Module: mlp, label: mlp.Label}).loss(loss, trainx, trainy)
 }
 
-// MeanSquaredLoss returns the sum of (predicted - wanted) for each elem in trainy
+// LossTensor builds the loss of the predictions of this mlp for the batch `x` against `y`, both 2D tensors, see ForwardsTensor
+func (mlp *MultiLayerPerceptron) LossTensor(loss TensorLoss, x, y *exptree.Tensor) *exptree.Tensor {
+	return (&trainee{Module: mlp, label: mlp.Label}).lossTensor(loss, x, y)
+}
+
+// MeanSquaredLoss returns the mean of (predicted - wanted) ^ 2 over each elem in trainy
 func (mlp *MultiLayerPerceptron) MeanSquaredLoss(trainx [][]*exptree.Node, trainy [][]*exptree.Node) *exptree.Node {
-	flattenedLosses := []*exptree.Node{}
-	for i, inputSet := range trainx {
-		pred := mlp.Forwards(inputSet)
-		for j, elem := range trainy[i] {
-			label := fmt.Sprintf("local_loss%d%d", i, j)
-			loss := exptree.SquaredDifference(label, pred[j], elem)
-			flattenedLosses = append(flattenedLosses, loss)
+	return mlp.Loss(MeanSquaredError{}, trainx, trainy)
+}
+
+// nodesToTensor gathers the data of rows of nodes into a 2D tensor
+func nodesToTensor(label string, rows [][]*exptree.Node) *exptree.Tensor {
+	values := [][]float64{}
+	for _, row := range rows {
+		value := []float64{}
+		for _, node := range row {
+			value = append(value, node.Data)
 		}
+		values = append(values, value)
 	}
-
-	return exptree.Add("loss_"+mlp.Label, flattenedLosses...)
-
+	return exptree.TensorFromRows(label, values)
 }
+
 func toNodes(inputs [][]float64, outputs [][]float64) ([][]*exptree.Node, [][]*exptree.Node) {
 	inNodes, outNodes := [][]*exptree.Node{}, [][]*exptree.Node{}
 	for i, in := range inputs {
 		mlpIn := []*exptree.Node{}
 		for idx, data := range in {
-			mlpIn = append(mlpIn, exptree.NewNode(fmt.Sprintf("r%din%d", i, idx), data))
+			mlpIn = append(mlpIn, exptree.NewConstant(fmt.Sprintf("r%din%d", i, idx), data))
 		}
 
 		inNodes = append(inNodes, mlpIn)
@@ -138,7 +267,7 @@ func toNodes(inputs [][]float64, outputs [][]float64) ([][]*exptree.Node, [][]*e
 	for j, out := range outputs {
 		mlpOut := []*exptree.Node{}
 		for idx, data := range out {
-			mlpOut = append(mlpOut, exptree.NewNode(fmt.Sprintf("r%dout%d", j, idx), data))
+			mlpOut = append(mlpOut, exptree.NewConstant(fmt.Sprintf("r%dout%d", j, idx), data))
 		}
 
 		outNodes = append(outNodes, mlpOut)
@@ -0,0 +1,232 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+)
+
+// ModuleNeuron, ModuleLayer, ModulePerceptron, ModuleSequential, ModuleGraph, ModuleDropout, ModuleConv1D, ModuleMaxPool1D
+// and ModuleAvgPool1D are the types written by ToJSONMap under "type" for the builtin modules, along with
+// NormalizationBatch and NormalizationLayer
+const (
+	ModuleNeuron     = "neuron"
+	ModuleLayer      = "layer"
+	ModulePerceptron = "mlp"
+	ModuleSequential = "sequential"
+	ModuleGraph      = "graph"
+	ModuleDropout    = "dropout"
+	ModuleConv1D     = "conv1d"
+	ModuleMaxPool1D  = "max_pool1d"
+	ModuleAvgPool1D  = "avg_pool1d"
+)
+
+// Module is a building block of a network, computing outputs from inputs with exptree nodes so gradients flow through it.
+// Neuron (see AsModule), Layer, MultiLayerPerceptron, Sequential, Graph, Dropout, BatchNorm, LayerNorm, Conv1D and Pool1D are modules, and they can be mixed
+// with custom ones in a Sequential. A module can implement the optional interfaces below to run faster or to take part
+// in training modes.
+type Module interface {
+	// Forwards computes the outputs of the module for a single row `in`
+	Forwards(in []*exptree.Node) []*exptree.Node
+	// Parameters returns every trainable node of the module exactly once, in a stable order
+	Parameters() []*Parameter
+	// ToJSONMap describes the module, including its "type" so it can be loaded back, see RegisterModule
+	ToJSONMap() map[string]any
+	// ZeroGradient sets the gradients of the parameters to 0
+	ZeroGradient()
+}
+
+// BatchModule is a module computing the outputs of a whole batch at once, needed when rows depend on each other as in BatchNorm.
+// Other modules see the rows of a batch one by one.
+type BatchModule interface {
+	Module
+	ForwardsBatch(in [][]*exptree.Node) [][]*exptree.Node
+}
+
+// TensorModule is a module that can run on a whole batch of shape [batch, inputs] as tensors, see WithVectorized
+type TensorModule interface {
+	Module
+	ForwardsTensor(in *exptree.Tensor) *exptree.Tensor
+}
+
+// Predictor is a module computing its outputs from plain values without building an expression tree.
+// Other modules build a throwaway tree to predict.
+type Predictor interface {
+	Module
+	Predict(in []float64) []float64
+}
+
+// ModeSwitcher is a module behaving differently while training and in inference, e.g. Dropout
+type ModeSwitcher interface {
+	Module
+	SetTraining(training bool)
+}
+
+// Sized is a module with a fixed number of inputs and outputs. Modules that are not keep the size of their inputs, e.g. Dropout.
+type Sized interface {
+	Module
+	InputSize() int
+	OutputSize() int
+}
+
+// forwardsBatch computes the outputs of `m` for each row of `in`, at once if it is a BatchModule
+func forwardsBatch(m Module, in [][]*exptree.Node) [][]*exptree.Node {
+	if b, ok := m.(BatchModule); ok {
+		return b.ForwardsBatch(in)
+	}
+	out := [][]*exptree.Node{}
+	for _, row := range in {
+		out = append(out, m.Forwards(row))
+	}
+	return out
+}
+
+// forwardsTensor computes the outputs of `m` for the batch `in`, panics if `m` is not a TensorModule
+func forwardsTensor(m Module, in *exptree.Tensor) *exptree.Tensor {
+	t, ok := m.(TensorModule)
+	if !ok {
+		panic(fmt.Sprintf("module %T cannot be computed with tensors", m))
+	}
+	return t.ForwardsTensor(in)
+}
+
+// predict computes the outputs of `m` for `in`, building a throwaway tree if it is not a Predictor
+func predict(m Module, in []float64) []float64 {
+	if p, ok := m.(Predictor); ok {
+		return p.Predict(in)
+	}
+	nodes := []*exptree.Node{}
+	for i, x := range in {
+		nodes = append(nodes, exptree.NewConstant(fmt.Sprintf("predict_in%d", i), x))
+	}
+	return nodesData(m.Forwards(nodes))
+}
+
+// setTraining switches `m` to training or inference mode if it is a ModeSwitcher
+func setTraining(m Module, training bool) {
+	if s, ok := m.(ModeSwitcher); ok {
+		s.SetTraining(training)
+	}
+}
+
+// isTraining returns whether `m` is in training mode, false if it does not tell
+func isTraining(m Module) bool {
+	switch m := m.(type) {
+	case *Dropout:
+		return m.Training
+	case *BatchNorm:
+		return m.Training
+	case interface{ Training() bool }:
+		return m.Training()
+	}
+	return false
+}
+
+// saveTraining records the mode of `m` and of every module under it, returning a function switching each back to it.
+// Containers are switched back before the modules they hold, so modules in another mode than their container keep it.
+func saveTraining(m Module) (restore func()) {
+	modules, modes := []Module{}, []bool{}
+	walk(m, func(m Module) {
+		modules, modes = append(modules, m), append(modes, isTraining(m))
+	})
+	return func() {
+		for i, m := range modules {
+			if s, ok := m.(ModeSwitcher); ok {
+				s.SetTraining(modes[i])
+			}
+		}
+	}
+}
+
+// submodules returns the modules directly held by `m`, in order
+func submodules(m Module) []Module {
+	switch m := m.(type) {
+	case *Sequential:
+		return m.Modules
+	case *Conv1D:
+		return []Module{m.Kernel}
+	case *Graph:
+		modules := []Module{}
+		for _, node := range m.Nodes {
+			if node.Module != nil {
+				modules = append(modules, node.Module)
+			}
+		}
+		return modules
+	case *MultiLayerPerceptron:
+		modules := []Module{}
+		for i := range m.Layers {
+			modules = append(modules, m.Layers[i])
+			if normalization := m.normalization(i); normalization != nil {
+				modules = append(modules, normalization)
+			}
+			if dropout := m.dropout(i); dropout != nil {
+				modules = append(modules, dropout)
+			}
+		}
+		return modules
+	}
+	return nil
+}
+
+// walk calls `fn` on `m` and every module under it, parents first
+func walk(m Module, fn func(m Module)) {
+	fn(m)
+	for _, sub := range submodules(m) {
+		walk(sub, fn)
+	}
+}
+
+// buffers returns the state of `m` that changes while training without being trained, e.g. the running averages of BatchNorm
+func buffers(m Module) [][]float64 {
+	buffers := [][]float64{}
+	walk(m, func(m Module) {
+		if b, ok := m.(interface{ buffers() [][]float64 }); ok {
+			buffers = append(buffers, b.buffers()...)
+		}
+	})
+	return buffers
+}
+
+// UpdateRunningAverages folds the statistics of the last batch into the running averages of every module under `m`
+// keeping some, such as BatchNorm. Train calls it after each optimizer step.
+func UpdateRunningAverages(m Module) {
+	walk(m, func(m Module) {
+		if r, ok := m.(interface{ UpdateRunning() }); ok {
+			r.UpdateRunning()
+		}
+	})
+}
+
+// dropouts returns every dropout under `m`, in order
+func dropouts(m Module) []*Dropout {
+	dropouts := []*Dropout{}
+	walk(m, func(m Module) {
+		if d, ok := m.(*Dropout); ok {
+			dropouts = append(dropouts, d)
+		}
+	})
+	return dropouts
+}
+
+// checkTensor validates that `m` can be computed with tensors
+func checkTensor(m Module) error {
+	if layer, ok := m.(*Layer); ok {
+		_, err := layer.tensorActivation()
+		return err
+	} else if _, ok := m.(TensorModule); !ok {
+		return fmt.Errorf("module %T cannot be computed with tensors", m)
+	}
+	for _, sub := range submodules(m) {
+		if err := checkTensor(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zeroGradient sets the gradients of `params` to 0
+func zeroGradient(params []*Parameter) {
+	for _, p := range params {
+		p.Gradient = 0
+	}
+}
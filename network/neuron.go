@@ -2,7 +2,6 @@ package network
 
 import (
 	"fmt"
-	"math/rand"
 	"nn/network/exptree"
 )
 
@@ -12,35 +11,39 @@ type Neuron struct {
 	NumberInputs int
 	Weights      []*exptree.Node // of size `NumberInputs`
 	Bias         *exptree.Node
-
-	//TODO modularize
-	Activation func(in *exptree.Node) (out *exptree.Node)
+	Activation   *Activation
 }
 
 // NewNeuron initializes a neuron with `inputsize` random floats
 // if `label` is supplied, it is prefixed to the label of the weights
-func NewNeuron(label string, inputsize int) *Neuron {
-	weights := []*exptree.Node{}
+// the activation defaults to tanh and can be changed with WithActivation
+// the weights are drawn with XavierUniform and the bias is 0, see WithInitializer, WithBiasInitializer and WithRand
+func NewNeuron(label string, inputsize int, opts ...Option) *Neuron {
+	options := newOptions(opts...)
+	weights, biases := options.initialize(inputsize, 1)
+	return newNeuronFromValues(label, weights[0], biases[0], mustGetActivation(options.Activation))
+}
 
-	for i := 0; i < inputsize; i++ {
+// newNeuronFromValues builds a neuron holding `weights` and `bias`
+func newNeuronFromValues(label string, weights []float64, bias float64, activation *Activation) *Neuron {
+	weightNodes := []*exptree.Node{}
+	for i := range weights {
 		weightLabel := fmt.Sprintf("%s_w%d", label, i)
-		weight := exptree.NewNode(weightLabel, 1.0/float64(inputsize))
-		weights = append(weights, weight)
+		weightNodes = append(weightNodes, exptree.NewNode(weightLabel, weights[i]))
 	}
 
 	biasLabel := fmt.Sprintf("%s_bias", label)
-	bias := exptree.NewNode(biasLabel, rand.Float64())
 
 	return &Neuron{
 		Label:        label,
-		NumberInputs: inputsize,
-		Weights:      weights,
-		Bias:         bias,
-		Activation:   func(n *exptree.Node) *exptree.Node { return exptree.Tanh(fmt.Sprintf("%s_tanh", label), n) },
+		NumberInputs: len(weights),
+		Weights:      weightNodes,
+		Bias:         exptree.NewNode(biasLabel, bias),
+		Activation:   activation,
 	}
 }
 
-// Forwards computes sum(xiwi) + b followed by calling the activation function.
+// Forwards computes sum(xiwi) + b followed by applying the activation.
 // `input` should have len `Neuron.NumberInputs`, or will panic
 func (n *Neuron) Forwards(input []*exptree.Node) *exptree.Node {
 	if len(input) != n.NumberInputs {
@@ -64,26 +67,79 @@ func (n *Neuron) Forwards(input []*exptree.Node) *exptree.Node {
 	productSum = exptree.Add(neuronProductSumLabel, products...)
 
 	preActivationOutput := exptree.Add(neuronPreActivationOutputLabel, productSum, n.Bias)
-	postActivationOutput := exptree.Tanh(neuronPostActivationOutputLabel, preActivationOutput)
+	postActivationOutput := n.Activation.Apply(neuronPostActivationOutputLabel, preActivationOutput)
 
 	return postActivationOutput
 }
 
-// Parameters returns the weights of this neuron
-func (n *Neuron) Parameters() []*exptree.Node {
-	return append(n.Weights, n.Bias)
+// NeuronModule is a neuron taking part in a network as a Module, its output being a single node, see Neuron.AsModule
+type NeuronModule struct {
+	*Neuron
+}
+
+// AsModule returns the neuron as a Module, so it can be mixed with other modules in a Sequential
+func (n *Neuron) AsModule() *NeuronModule {
+	return &NeuronModule{Neuron: n}
+}
+
+// Forwards computes the output of the neuron as a slice of a single node, see Neuron.Forwards
+func (m *NeuronModule) Forwards(input []*exptree.Node) []*exptree.Node {
+	return []*exptree.Node{m.Neuron.Forwards(input)}
+}
+
+// Predict computes the output of the neuron as a slice of a single value, see Neuron.Predict
+func (m *NeuronModule) Predict(input []float64) []float64 {
+	return []float64{m.Neuron.Predict(input)}
 }
+
+// Parameters returns the weights followed by the bias of this neuron
+func (n *Neuron) Parameters() []*Parameter {
+	params := make([]*Parameter, 0, len(n.Weights)+1)
+	for i := range n.Weights {
+		params = append(params, &Parameter{
+			Node:  n.Weights[i],
+			Name:  fmt.Sprintf("%s_w%d", n.Label, i),
+			Layer: n.Label,
+			Kind:  ParameterWeight,
+		})
+	}
+	params = append(params, &Parameter{
+		Node:  n.Bias,
+		Name:  fmt.Sprintf("%s_bias", n.Label),
+		Layer: n.Label,
+		Kind:  ParameterBias,
+	})
+	return params
+}
+
+// ZeroGradient sets the gradients of the weights and the bias to 0
+func (n *Neuron) ZeroGradient() {
+	zeroGradient(n.Parameters())
+}
+
+// InputSize returns the number of inputs of the neuron
+func (n *Neuron) InputSize() int {
+	return n.NumberInputs
+}
+
+// OutputSize returns 1, a neuron has a single output
+func (n *Neuron) OutputSize() int {
+	return 1
+}
+
 func (n *Neuron) String() string {
-	return fmt.Sprintf("[Neuron %s | Input Size %d| Weights %v | Bias %v]", n.Label, n.NumberInputs, n.Weights, n.Bias)
+	return fmt.Sprintf("[Neuron %s | Input Size %d| Weights %v | Bias %v | Activation %s]", n.Label, n.NumberInputs, n.Weights, n.Bias, n.Activation.Name)
 }
 
 func (n *Neuron) ToJSONMap() map[string]any {
 	data := map[string]any{
+		"type":           ModuleNeuron,
 		"label":          n.Label,
 		"number_inputs":  n.NumberInputs,
 		"number_outputs": 1,
 		"weights":        n.getWeightsFloat64(),
 		"bias":           n.Bias.Data,
+		"activation":     n.Activation.Name,
 	}
 
 	return data
@@ -0,0 +1,404 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+)
+
+// NormalizationBatch and NormalizationLayer are the kinds of normalization a perceptron can apply after a layer, see WithNormalization
+const (
+	NormalizationBatch = "batch_norm"
+	NormalizationLayer = "layer_norm"
+)
+
+// ParameterScale and ParameterShift are the kinds of parameters held by normalizations, gamma and beta
+const (
+	ParameterScale ParameterKind = "scale"
+	ParameterShift ParameterKind = "shift"
+)
+
+// Normalization rescales the outputs of a layer, learning a scale `gamma` and a shift `beta` for each output.
+// ForwardsBatch normalizes rows of the same size, ForwardsTensor a batch of shape [batch, size]
+// and Predict a single row of plain values as in inference mode.
+type Normalization interface {
+	BatchModule
+	TensorModule
+	Predictor
+	ModeSwitcher
+	Sized
+}
+
+// BatchNorm normalizes each output of a layer over the rows of a batch to a mean of 0 and a variance of 1, before scaling and shifting it.
+// While training the statistics of the batch are used, and running averages of them are kept for inference, see UpdateRunning.
+// for x of a batch
+// y = gamma * (x - mean(x)) / sqrt(var(x) + epsilon) + beta
+type BatchNorm struct {
+	Label       string
+	Size        int
+	Gamma       []*exptree.Node
+	Beta        []*exptree.Node
+	RunningMean []float64
+	RunningVar  []float64
+	Momentum    float64 // weight of the statistics of each batch in the running averages
+	Epsilon     float64
+	Training    bool
+
+	batchMean []float64 // statistics of the last batch normalized while training, see UpdateRunning
+	batchVar  []float64
+	batchRows int // rows of the last batch, 0 once folded into the running averages
+}
+
+// NewBatchNorm creates a batch normalization of `size` outputs, with a gamma of 1, a beta of 0, a momentum of 0.1 and an epsilon of 1e-5
+func NewBatchNorm(label string, size int) *BatchNorm {
+	b := &BatchNorm{
+		Label:       label,
+		Size:        size,
+		RunningMean: make([]float64, size),
+		RunningVar:  make([]float64, size),
+		Momentum:    0.1,
+		Epsilon:     1e-5,
+	}
+	b.Gamma, b.Beta = newScaleShift(label, size)
+	for j := range b.RunningVar {
+		b.RunningVar[j] = 1
+	}
+	return b
+}
+
+// Forwards normalizes a batch of the single row `in`, see ForwardsBatch
+func (b *BatchNorm) Forwards(in []*exptree.Node) []*exptree.Node {
+	return b.ForwardsBatch([][]*exptree.Node{in})[0]
+}
+
+// ForwardsBatch normalizes each column of `in`. While training it normalizes with the statistics of the batch, kept for
+// UpdateRunning. A single row has a variance of 0, so it is normalized with the running averages even while training.
+func (b *BatchNorm) ForwardsBatch(in [][]*exptree.Node) [][]*exptree.Node {
+	checkNormalizationRows(b.Label, b.Size, in)
+	output := make([][]*exptree.Node, len(in))
+	for i := range output {
+		output[i] = make([]*exptree.Node, b.Size)
+	}
+	batch := b.Training && len(in) > 1
+	means, variances := make([]float64, b.Size), make([]float64, b.Size)
+
+	for j := 0; j < b.Size; j++ {
+		label := fmt.Sprintf("%s_%d", b.Label, j)
+		column := []*exptree.Node{}
+		for i := range in {
+			column = append(column, in[i][j])
+		}
+
+		var normalized []*exptree.Node
+		if batch {
+			normalized, means[j], variances[j] = standardize(label, b.Epsilon, column...)
+		} else {
+			mean := exptree.NewConstant(label+"_running_mean", b.RunningMean[j])
+			invstd := exptree.NewConstant(label+"_running_invstd", 1/math.Sqrt(b.RunningVar[j]+b.Epsilon))
+			for i, x := range column {
+				centered := exptree.Sub(fmt.Sprintf("%s_r%d_centered", label, i), x, mean)
+				normalized = append(normalized, exptree.Multiply(fmt.Sprintf("%s_r%d_normalized", label, i), centered, invstd))
+			}
+		}
+
+		for i := range normalized {
+			output[i][j] = scaleShift(fmt.Sprintf("%s_r%d", label, i), b.Gamma[j], b.Beta[j], normalized[i])
+		}
+	}
+	if batch {
+		b.record(means, variances, len(in))
+	}
+	return output
+}
+
+// ForwardsTensor is ForwardsBatch for a batch of shape [batch, Size]
+func (b *BatchNorm) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	checkNormalizationTensor(b.Label, b.Size, in)
+	var normalized *exptree.Tensor
+	if b.Training && in.Shape[0] > 1 {
+		mean := exptree.TensorMean(b.Label+"_mean", in, 0)
+		centered := exptree.TensorSub(b.Label+"_centered", in, mean)
+		variance := exptree.TensorMean(b.Label+"_variance", exptree.TensorMultiply(b.Label+"_square", centered, centered), 0)
+		normalized = exptree.TensorMultiply(b.Label+"_normalized", centered, inverseStd(b.Label+"_invstd", variance, b.Epsilon))
+		b.record(append([]float64{}, mean.Data...), append([]float64{}, variance.Data...), in.Shape[0])
+	} else {
+		mean := exptree.NewTensor(b.Label+"_running_mean", []int{b.Size}, append([]float64{}, b.RunningMean...))
+		invstd := exptree.NewTensor(b.Label+"_running_invstd", []int{b.Size}, nil)
+		for j := range invstd.Data {
+			invstd.Data[j] = 1 / math.Sqrt(b.RunningVar[j]+b.Epsilon)
+		}
+		normalized = exptree.TensorMultiply(b.Label+"_normalized", exptree.TensorSub(b.Label+"_centered", in, mean), invstd)
+	}
+	return scaleShiftTensor(b.Label, b.Gamma, b.Beta, normalized)
+}
+
+// Predict normalizes `in` with the running averages
+func (b *BatchNorm) Predict(in []float64) []float64 {
+	output := make([]float64, len(in))
+	for j, x := range in {
+		normalized := (x - b.RunningMean[j]) * (1 / math.Sqrt(b.RunningVar[j]+b.Epsilon))
+		output[j] = b.Gamma[j].Data*normalized + b.Beta[j].Data
+	}
+	return output
+}
+
+// record keeps the statistics of a batch of `n` rows until UpdateRunning folds them into the running averages
+func (b *BatchNorm) record(mean, variance []float64, n int) {
+	b.batchMean, b.batchVar, b.batchRows = mean, variance, n
+}
+
+// UpdateRunning folds the statistics of the last batch normalized while training into the running averages, the variance
+// being the unbiased one. It does nothing if no batch was normalized since the last call.
+// Train calls it after each optimizer step, see UpdateRunningAverages for training loops of your own.
+func (b *BatchNorm) UpdateRunning() {
+	if b.batchRows == 0 {
+		return
+	}
+	correction := float64(b.batchRows) / float64(b.batchRows-1)
+	for j := range b.RunningMean {
+		b.RunningMean[j] = (1-b.Momentum)*b.RunningMean[j] + b.Momentum*b.batchMean[j]
+		b.RunningVar[j] = (1-b.Momentum)*b.RunningVar[j] + b.Momentum*b.batchVar[j]*correction
+	}
+	b.batchRows = 0
+}
+
+// Parameters returns gamma then beta of each output
+func (b *BatchNorm) Parameters() []*Parameter {
+	return scaleShiftParameters(b.Label, b.Gamma, b.Beta)
+}
+
+// ZeroGradient sets the gradients of gamma and beta to 0
+func (b *BatchNorm) ZeroGradient() {
+	zeroGradient(b.Parameters())
+}
+
+// SetTraining switches between the statistics of the batch and the running averages
+func (b *BatchNorm) SetTraining(training bool) {
+	b.Training = training
+}
+
+// InputSize returns the number of outputs normalized
+func (b *BatchNorm) InputSize() int {
+	return b.Size
+}
+
+// OutputSize returns the number of outputs normalized
+func (b *BatchNorm) OutputSize() int {
+	return b.Size
+}
+
+// buffers returns the running averages, which are not trained but change while training
+func (b *BatchNorm) buffers() [][]float64 {
+	return [][]float64{b.RunningMean, b.RunningVar}
+}
+
+func (b *BatchNorm) ToJSONMap() map[string]any {
+	return map[string]any{
+		"type":         NormalizationBatch,
+		"name":         b.Label,
+		"size":         b.Size,
+		"gamma":        nodesData(b.Gamma),
+		"beta":         nodesData(b.Beta),
+		"running_mean": b.RunningMean,
+		"running_var":  b.RunningVar,
+		"momentum":     b.Momentum,
+		"epsilon":      b.Epsilon,
+	}
+}
+
+// LayerNorm normalizes the outputs of a layer over each row to a mean of 0 and a variance of 1, before scaling and shifting them.
+// It behaves the same while training and in inference.
+// for x a row
+// y = gamma * (x - mean(x)) / sqrt(var(x) + epsilon) + beta
+type LayerNorm struct {
+	Label   string
+	Size    int
+	Gamma   []*exptree.Node
+	Beta    []*exptree.Node
+	Epsilon float64
+}
+
+// NewLayerNorm creates a layer normalization of `size` outputs, with a gamma of 1, a beta of 0 and an epsilon of 1e-5
+func NewLayerNorm(label string, size int) *LayerNorm {
+	l := &LayerNorm{Label: label, Size: size, Epsilon: 1e-5}
+	l.Gamma, l.Beta = newScaleShift(label, size)
+	return l
+}
+
+// Forwards normalizes the row `in`
+func (l *LayerNorm) Forwards(in []*exptree.Node) []*exptree.Node {
+	return l.ForwardsBatch([][]*exptree.Node{in})[0]
+}
+
+// ForwardsBatch normalizes each row of `in`
+func (l *LayerNorm) ForwardsBatch(in [][]*exptree.Node) [][]*exptree.Node {
+	checkNormalizationRows(l.Label, l.Size, in)
+	output := [][]*exptree.Node{}
+	for i, row := range in {
+		label := fmt.Sprintf("%s_r%d", l.Label, i)
+		normalized, _, _ := standardize(label, l.Epsilon, row...)
+		out := []*exptree.Node{}
+		for j := range normalized {
+			out = append(out, scaleShift(fmt.Sprintf("%s_%d", label, j), l.Gamma[j], l.Beta[j], normalized[j]))
+		}
+		output = append(output, out)
+	}
+	return output
+}
+
+// ForwardsTensor is ForwardsBatch for a batch of shape [batch, Size]
+func (l *LayerNorm) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	checkNormalizationTensor(l.Label, l.Size, in)
+	mean := exptree.Reshape(l.Label+"_mean_column", exptree.TensorMean(l.Label+"_mean", in, 1), -1, 1)
+	centered := exptree.TensorSub(l.Label+"_centered", in, mean)
+	variance := exptree.TensorMean(l.Label+"_variance", exptree.TensorMultiply(l.Label+"_square", centered, centered), 1)
+	invstd := exptree.Reshape(l.Label+"_invstd_column", inverseStd(l.Label+"_invstd", variance, l.Epsilon), -1, 1)
+	return scaleShiftTensor(l.Label, l.Gamma, l.Beta, exptree.TensorMultiply(l.Label+"_normalized", centered, invstd))
+}
+
+// Predict normalizes `in`
+func (l *LayerNorm) Predict(in []float64) []float64 {
+	mean := 0.0
+	for _, x := range in {
+		mean += x
+	}
+	mean /= float64(len(in))
+	variance := 0.0
+	for _, x := range in {
+		variance += (x - mean) * (x - mean)
+	}
+	invstd := 1 / math.Sqrt(variance/float64(len(in))+l.Epsilon)
+
+	output := make([]float64, len(in))
+	for j, x := range in {
+		output[j] = l.Gamma[j].Data*((x-mean)*invstd) + l.Beta[j].Data
+	}
+	return output
+}
+
+// Parameters returns gamma then beta of each output
+func (l *LayerNorm) Parameters() []*Parameter {
+	return scaleShiftParameters(l.Label, l.Gamma, l.Beta)
+}
+
+// ZeroGradient sets the gradients of gamma and beta to 0
+func (l *LayerNorm) ZeroGradient() {
+	zeroGradient(l.Parameters())
+}
+
+// SetTraining does nothing, layer normalization behaves the same in both modes
+func (l *LayerNorm) SetTraining(training bool) {}
+
+// InputSize returns the number of outputs normalized
+func (l *LayerNorm) InputSize() int {
+	return l.Size
+}
+
+// OutputSize returns the number of outputs normalized
+func (l *LayerNorm) OutputSize() int {
+	return l.Size
+}
+
+func (l *LayerNorm) ToJSONMap() map[string]any {
+	return map[string]any{
+		"type":    NormalizationLayer,
+		"name":    l.Label,
+		"size":    l.Size,
+		"gamma":   nodesData(l.Gamma),
+		"beta":    nodesData(l.Beta),
+		"epsilon": l.Epsilon,
+	}
+}
+
+// newNormalization creates the normalization of `kind` for `size` outputs, nil for an empty kind
+func newNormalization(kind, label string, size int) (Normalization, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case NormalizationBatch:
+		return NewBatchNorm(label, size), nil
+	case NormalizationLayer:
+		return NewLayerNorm(label, size), nil
+	}
+	return nil, fmt.Errorf("unknown normalization `%s`", kind)
+}
+
+// standardize shifts and scales `nodes` to a mean of 0 and a variance of 1, returning the mean and the biased variance
+func standardize(label string, epsilon float64, nodes ...*exptree.Node) (normalized []*exptree.Node, mean, variance float64) {
+	meanNode := exptree.Mean(label+"_mean", nodes...)
+	centered, squares := []*exptree.Node{}, []*exptree.Node{}
+	for i, x := range nodes {
+		c := exptree.Sub(fmt.Sprintf("%s_centered%d", label, i), x, meanNode)
+		centered = append(centered, c)
+		squares = append(squares, exptree.Power(fmt.Sprintf("%s_square%d", label, i), exptree.NewConstant(label+"_two", 2), c))
+	}
+	varianceNode := exptree.Mean(label+"_variance", squares...)
+	invstd := exptree.Power(label+"_invstd", exptree.NewConstant(label+"_minus_half", -0.5),
+		exptree.Add(label+"_variance_epsilon", varianceNode, exptree.NewConstant(label+"_epsilon", epsilon)))
+
+	for i, c := range centered {
+		normalized = append(normalized, exptree.Multiply(fmt.Sprintf("%s_normalized%d", label, i), c, invstd))
+	}
+	return normalized, meanNode.Data, varianceNode.Data
+}
+
+// inverseStd computes 1 / sqrt(v + epsilon) of every value of `variance`.
+// for y = (v + epsilon) ^ -0.5
+// dy/dv = -0.5 * y ^ 3
+func inverseStd(label string, variance *exptree.Tensor, epsilon float64) *exptree.Tensor {
+	return exptree.TensorUnary(label, exptree.OperationPowerOf, variance,
+		func(x float64) float64 { return 1 / math.Sqrt(x+epsilon) },
+		func(x, y float64) float64 { return -0.5 * y * y * y })
+}
+
+// scaleShift computes gamma * x + beta
+func scaleShift(label string, gamma, beta, x *exptree.Node) *exptree.Node {
+	return exptree.Add(label, exptree.Multiply(label+"_scaled", gamma, x), beta)
+}
+
+// scaleShiftTensor computes gamma * x + beta for every row of `x`, gathering gamma and beta into tensors
+// whose gradients are passed back to their nodes, as Layer.ForwardsTensor does for weights
+func scaleShiftTensor(label string, gamma, beta []*exptree.Node, x *exptree.Tensor) *exptree.Tensor {
+	scaled := exptree.TensorMultiply(label+"_scaled", x, exptree.TensorFromNodes(label+"_gamma", []int{len(gamma)}, gamma))
+	return exptree.TensorAdd(label, scaled, exptree.TensorFromNodes(label+"_beta", []int{len(beta)}, beta))
+}
+
+func newScaleShift(label string, size int) (gamma, beta []*exptree.Node) {
+	for j := 0; j < size; j++ {
+		gamma = append(gamma, exptree.NewNode(fmt.Sprintf("%s_gamma%d", label, j), 1))
+		beta = append(beta, exptree.NewNode(fmt.Sprintf("%s_beta%d", label, j), 0))
+	}
+	return gamma, beta
+}
+
+func scaleShiftParameters(label string, gamma, beta []*exptree.Node) []*Parameter {
+	params := []*Parameter{}
+	for j := range gamma {
+		params = append(params,
+			&Parameter{Node: gamma[j], Name: fmt.Sprintf("%s_gamma%d", label, j), Layer: label, Kind: ParameterScale},
+			&Parameter{Node: beta[j], Name: fmt.Sprintf("%s_beta%d", label, j), Layer: label, Kind: ParameterShift})
+	}
+	return params
+}
+
+func nodesData(nodes []*exptree.Node) []float64 {
+	data := make([]float64, len(nodes))
+	for i, node := range nodes {
+		data[i] = node.Data
+	}
+	return data
+}
+
+func checkNormalizationRows(label string, size int, in [][]*exptree.Node) {
+	for i := range in {
+		if len(in[i]) != size {
+			panic(fmt.Sprintf("mismatch in normalization `%s` dimensions: want %d, got %d in row %d", label, size, len(in[i]), i))
+		}
+	}
+}
+
+func checkNormalizationTensor(label string, size int, in *exptree.Tensor) {
+	if len(in.Shape) != 2 || in.Shape[1] != size {
+		panic(fmt.Sprintf("mismatch in normalization `%s` dimensions: want [batch, %d], got %v", label, size, in.Shape))
+	}
+}
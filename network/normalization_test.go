@@ -0,0 +1,197 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+	"testing"
+)
+
+// normalizationBatch holds three rows of two columns, the first of mean 3 and variance 8/3, the second of mean 14 and variance 32/3
+var normalizationBatch = [][]float64{{1, 10}, {3, 14}, {5, 18}}
+
+// rowNodes turns `rows` into trainable nodes
+func rowNodes(rows [][]float64) [][]*exptree.Node {
+	nodes := [][]*exptree.Node{}
+	for i, row := range rows {
+		nodes = append(nodes, []*exptree.Node{})
+		for j, x := range row {
+			nodes[i] = append(nodes[i], exptree.NewNode(fmt.Sprintf("x%d_%d", i, j), x))
+		}
+	}
+	return nodes
+}
+
+// weightedSum adds up the outputs weighted by distinct constants, as a plain sum of normalized values has no gradient
+func weightedSum(out [][]*exptree.Node) *exptree.Node {
+	terms := []*exptree.Node{}
+	for i := range out {
+		for j := range out[i] {
+			weight := exptree.NewConstant(fmt.Sprintf("c%d_%d", i, j), math.Sin(float64(3*i+j+1)))
+			terms = append(terms, exptree.Multiply(fmt.Sprintf("term%d_%d", i, j), weight, out[i][j]))
+		}
+	}
+	return exptree.Add("loss", terms...)
+}
+
+func checkOutputs(t *testing.T, what string, out [][]*exptree.Node, want [][]float64) {
+	t.Helper()
+	for i := range want {
+		for j := range want[i] {
+			if math.Abs(out[i][j].Data-want[i][j]) > 1e-9 {
+				t.Fatalf("%s: output %d,%d is %.12g, want %.12g", what, i, j, out[i][j].Data, want[i][j])
+			}
+		}
+	}
+}
+
+func TestBatchNormModes(t *testing.T) {
+	b := NewBatchNorm("bn", 2)
+	b.Gamma[1].Data, b.Beta[1].Data = 2, 1
+	b.RunningMean[0], b.RunningVar[0] = 1, 4
+
+	// training normalizes with the statistics of the batch
+	b.SetTraining(true)
+	s0, s1 := math.Sqrt(8.0/3+b.Epsilon), math.Sqrt(32.0/3+b.Epsilon)
+	checkOutputs(t, "training", b.ForwardsBatch(rowNodes(normalizationBatch)),
+		[][]float64{{-2 / s0, 2*(-4/s1) + 1}, {0, 1}, {2 / s0, 2*(4/s1) + 1}})
+
+	// inference normalizes with the running averages, which training has not changed yet
+	b.SetTraining(false)
+	r0, r1 := math.Sqrt(4+b.Epsilon), math.Sqrt(1+b.Epsilon)
+	want := [][]float64{}
+	for _, row := range normalizationBatch {
+		want = append(want, []float64{(row[0] - 1) / r0, 2*row[1]/r1 + 1})
+	}
+	checkOutputs(t, "inference", b.ForwardsBatch(rowNodes(normalizationBatch)), want)
+	for i, row := range normalizationBatch {
+		if got := b.Predict(row); math.Abs(got[0]-want[i][0]) > 1e-12 || math.Abs(got[1]-want[i][1]) > 1e-12 {
+			t.Fatalf("predicts %v for row %d, want %v", got, i, want[i])
+		}
+	}
+}
+
+func TestBatchNormSingleRow(t *testing.T) {
+	// a single row has no variance, so it is normalized with the running averages even while training and records nothing
+	b := NewBatchNorm("bn", 2)
+	copy(b.RunningMean, []float64{1, 2})
+	copy(b.RunningVar, []float64{4, 9})
+	b.SetTraining(true)
+	for _, out := range [][]float64{
+		nodesData(b.Forwards([]*exptree.Node{exptree.NewNode("x0", 3), exptree.NewNode("x1", 8)})),
+		b.ForwardsTensor(exptree.TensorFromRows("x", [][]float64{{3, 8}})).Data,
+	} {
+		want := []float64{2 / math.Sqrt(4+b.Epsilon), 6 / math.Sqrt(9+b.Epsilon)}
+		if math.Abs(out[0]-want[0]) > 1e-12 || math.Abs(out[1]-want[1]) > 1e-12 {
+			t.Fatalf("single row normalized to %v, want %v", out, want)
+		}
+	}
+	b.UpdateRunning()
+	if b.RunningMean[0] != 1 || b.RunningVar[1] != 9 {
+		t.Fatalf("running averages moved to %v and %v by a single row", b.RunningMean, b.RunningVar)
+	}
+}
+
+func TestBatchNormUpdateRunning(t *testing.T) {
+	for _, tensor := range []bool{false, true} {
+		b := NewBatchNorm("bn", 2)
+		b.SetTraining(true)
+		if tensor {
+			b.ForwardsTensor(exptree.TensorFromRows("x", normalizationBatch))
+		} else {
+			b.ForwardsBatch(rowNodes(normalizationBatch))
+		}
+		if b.RunningMean[0] != 0 || b.RunningVar[0] != 1 {
+			t.Fatalf("tensor=%t: running averages moved before UpdateRunning", tensor)
+		}
+
+		// the unbiased variances of the columns are 4 and 16
+		b.UpdateRunning()
+		want := [][]float64{{0.1 * 3, 0.1 * 14}, {0.9 + 0.1*4, 0.9 + 0.1*16}}
+		for j := 0; j < 2; j++ {
+			if math.Abs(b.RunningMean[j]-want[0][j]) > 1e-12 || math.Abs(b.RunningVar[j]-want[1][j]) > 1e-12 {
+				t.Fatalf("tensor=%t: running averages %v and %v, want %v and %v", tensor, b.RunningMean, b.RunningVar, want[0], want[1])
+			}
+		}
+		b.UpdateRunning()
+		if math.Abs(b.RunningMean[0]-want[0][0]) > 1e-12 {
+			t.Fatalf("tensor=%t: the same batch was folded in twice", tensor)
+		}
+	}
+}
+
+func TestLayerNorm(t *testing.T) {
+	l := NewLayerNorm("ln", 4)
+	l.Gamma[3].Data, l.Beta[0].Data = 2, 1
+	// a mean of 2.5 and a variance of 1.25
+	s := math.Sqrt(1.25 + l.Epsilon)
+	want := []float64{-1.5/s + 1, -0.5 / s, 0.5 / s, 2 * 1.5 / s}
+	for _, out := range [][]float64{
+		nodesData(l.Forwards(rowNodes([][]float64{{1, 2, 3, 4}})[0])),
+		l.ForwardsTensor(exptree.TensorFromRows("x", [][]float64{{1, 2, 3, 4}})).Data,
+		l.Predict([]float64{1, 2, 3, 4}),
+	} {
+		for j := range want {
+			if math.Abs(out[j]-want[j]) > 1e-12 {
+				t.Fatalf("normalized to %v, want %v", out, want)
+			}
+		}
+	}
+}
+
+func TestNormalizationGradients(t *testing.T) {
+	training, inference := NewBatchNorm("bn", 2), NewBatchNorm("bn", 2)
+	training.SetTraining(true)
+	inference.RunningMean[1], inference.RunningVar[1] = 12, 9
+	tests := []struct {
+		name string
+		n    Normalization
+	}{
+		{"batch training", training},
+		{"batch inference", inference},
+		{"layer", NewLayerNorm("ln", 2)},
+	}
+
+	for _, test := range tests {
+		n := test.n
+		t.Run(test.name, func(t *testing.T) {
+			for j, p := range n.Parameters() {
+				p.Data += 0.1 * float64(j+1)
+			}
+			in := rowNodes(normalizationBatch)
+			root := weightedSum(n.ForwardsBatch(in))
+			if report := exptree.GradCheck(root, 1e-6, 1e-6); !report.Passed {
+				t.Fatal(report)
+			}
+
+			// the tensor path gets the same gradients for the inputs and the parameters
+			want := []float64{}
+			for _, p := range n.Parameters() {
+				want = append(want, p.Gradient)
+			}
+			n.ZeroGradient()
+			x := exptree.TensorFromRows("x", normalizationBatch)
+			out := n.ForwardsTensor(x)
+			exptree.ZeroTensorGradient(out)
+			for i := range out.Data {
+				out.Gradient[i] = math.Sin(float64(3*(i/2) + i%2 + 1))
+			}
+			tensors := exptree.TopologicalTensors(out)
+			for i := len(tensors) - 1; i >= 0; i-- {
+				tensors[i].GradientUpdater()
+			}
+			for j, p := range n.Parameters() {
+				if math.Abs(p.Gradient-want[j]) > 1e-9 {
+					t.Fatalf("tensor gradient of `%s` is %g, want %g", p.Name, p.Gradient, want[j])
+				}
+			}
+			for i := range in {
+				for j, node := range in[i] {
+					if got := x.Gradient[i*2+j]; math.Abs(got-node.Gradient) > 1e-9 {
+						t.Fatalf("tensor gradient of input %d,%d is %g, want %g", i, j, got, node.Gradient)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+)
+
+// Optimizer updates the data of parameters from their gradients.
+// Optimizers keep their per-parameter state keyed by Parameter.Name, so the same parameters should be passed to every Step.
+type Optimizer interface {
+	// Step applies a single update to every parameter in `params`
+	Step(params []*Parameter)
+	LearningRate() float64
+	SetLearningRate(learnrate float64)
+	// State returns a copy of the per-parameter buffers, for checkpointing
+	State() *OptimizerState
+	// SetState restores buffers returned by State
+	SetState(state *OptimizerState)
+}
+
+// OptimizerState is a snapshot of the buffers of an optimizer
+type OptimizerState struct {
+	Steps   int
+	Buffers map[string][]float64 // keyed by parameter name
+}
+
+// NodeStep adapts `optimizer` to exptree.OptimizeWith, so any tree can be minimized with it.
+// Each node is stepped as a parameter named after its label and position, keeping its state across passes.
+func NodeStep(optimizer Optimizer) func(nodes []*exptree.Node) {
+	return func(nodes []*exptree.Node) {
+		params := make([]*Parameter, len(nodes))
+		for i, node := range nodes {
+			params[i] = &Parameter{Node: node, Name: fmt.Sprintf("%s_%d", node.Label, i), Kind: ParameterWeight}
+		}
+		optimizer.Step(params)
+	}
+}
+
+// learnRate implements the learning rate accessors of an Optimizer
+type learnRate struct {
+	rate float64
+}
+
+// LearningRate returns the current learning rate
+func (l *learnRate) LearningRate() float64 { return l.rate }
+
+// SetLearningRate sets the learning rate used by the following steps
+func (l *learnRate) SetLearningRate(learnrate float64) { l.rate = learnrate }
+
+// moments holds the per-parameter buffers of an optimizer, keyed by parameter name
+type moments struct {
+	steps   int
+	buffers map[string][]float64
+}
+
+// get returns the `size` buffers of parameter `name`, creating them zeroed on first use
+func (m *moments) get(name string, size int) []float64 {
+	if m.buffers == nil {
+		m.buffers = map[string][]float64{}
+	}
+	buf, ok := m.buffers[name]
+	if !ok || len(buf) != size {
+		buf = make([]float64, size)
+		m.buffers[name] = buf
+	}
+	return buf
+}
+
+// State returns a copy of the buffers
+func (m *moments) State() *OptimizerState {
+	state := &OptimizerState{Steps: m.steps, Buffers: map[string][]float64{}}
+	for name, buf := range m.buffers {
+		state.Buffers[name] = append([]float64{}, buf...)
+	}
+	return state
+}
+
+// SetState replaces the buffers with a copy of `state`
+func (m *moments) SetState(state *OptimizerState) {
+	m.steps, m.buffers = state.Steps, map[string][]float64{}
+	for name, buf := range state.Buffers {
+		m.buffers[name] = append([]float64{}, buf...)
+	}
+}
+
+// SGD is stochastic gradient descent, optionally with (nesterov) momentum.
+// v = momentum * v + g
+// p = p - lr * v, or p = p - lr * (g + momentum * v) with nesterov
+type SGD struct {
+	learnRate
+	moments
+	Momentum float64
+	Nesterov bool
+}
+
+// NewSGD creates plain gradient descent
+func NewSGD(learnrate float64) *SGD {
+	return &SGD{learnRate: learnRate{learnrate}}
+}
+
+// NewMomentum creates gradient descent with classical momentum
+func NewMomentum(learnrate, momentum float64) *SGD {
+	return &SGD{learnRate: learnRate{learnrate}, Momentum: momentum}
+}
+
+// NewNesterov creates gradient descent with nesterov momentum
+func NewNesterov(learnrate, momentum float64) *SGD {
+	return &SGD{learnRate: learnRate{learnrate}, Momentum: momentum, Nesterov: true}
+}
+
+func (o *SGD) Step(params []*Parameter) {
+	o.steps++
+	for _, p := range params {
+		if o.Momentum == 0 {
+			p.Data += -o.rate * p.Gradient
+			continue
+		}
+		velocity := o.get(p.Name, 1)
+		velocity[0] = o.Momentum*velocity[0] + p.Gradient
+		update := velocity[0]
+		if o.Nesterov {
+			update = p.Gradient + o.Momentum*velocity[0]
+		}
+		p.Data += -o.rate * update
+	}
+}
+
+// Adagrad scales the learning rate of each parameter by its accumulated squared gradients.
+// s = s + g^2
+// p = p - lr * g / (sqrt(s) + epsilon)
+type Adagrad struct {
+	learnRate
+	moments
+	Epsilon float64
+}
+
+// NewAdagrad creates Adagrad with epsilon 1e-10
+func NewAdagrad(learnrate float64) *Adagrad {
+	return &Adagrad{learnRate: learnRate{learnrate}, Epsilon: 1e-10}
+}
+
+func (o *Adagrad) Step(params []*Parameter) {
+	o.steps++
+	for _, p := range params {
+		sum := o.get(p.Name, 1)
+		sum[0] += p.Gradient * p.Gradient
+		p.Data += -o.rate * p.Gradient / (math.Sqrt(sum[0]) + o.Epsilon)
+	}
+}
+
+// RMSProp scales the learning rate of each parameter by a moving average of its squared gradients.
+// s = decay * s + (1 - decay) * g^2
+// p = p - lr * g / (sqrt(s) + epsilon)
+type RMSProp struct {
+	learnRate
+	moments
+	Decay   float64
+	Epsilon float64
+}
+
+// NewRMSProp creates RMSProp with decay 0.9 and epsilon 1e-8
+func NewRMSProp(learnrate float64) *RMSProp {
+	return &RMSProp{learnRate: learnRate{learnrate}, Decay: 0.9, Epsilon: 1e-8}
+}
+
+func (o *RMSProp) Step(params []*Parameter) {
+	o.steps++
+	for _, p := range params {
+		avg := o.get(p.Name, 1)
+		avg[0] = o.Decay*avg[0] + (1-o.Decay)*p.Gradient*p.Gradient
+		p.Data += -o.rate * p.Gradient / (math.Sqrt(avg[0]) + o.Epsilon)
+	}
+}
+
+// Adam keeps bias corrected moving averages of the gradient and the squared gradient of each parameter.
+// m = beta1 * m + (1 - beta1) * g
+// v = beta2 * v + (1 - beta2) * g^2
+// p = p - lr * m / (1 - beta1^t) / (sqrt(v / (1 - beta2^t)) + epsilon)
+type Adam struct {
+	learnRate
+	moments
+	Beta1   float64
+	Beta2   float64
+	Epsilon float64
+}
+
+// NewAdam creates Adam with beta1 0.9, beta2 0.999 and epsilon 1e-8
+func NewAdam(learnrate float64) *Adam {
+	return &Adam{learnRate: learnRate{learnrate}, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+}
+
+func (o *Adam) Step(params []*Parameter) {
+	o.steps++
+	for _, p := range params {
+		o.update(p)
+	}
+}
+
+func (o *Adam) update(p *Parameter) {
+	m := o.get(p.Name, 2)
+	m[0] = o.Beta1*m[0] + (1-o.Beta1)*p.Gradient
+	m[1] = o.Beta2*m[1] + (1-o.Beta2)*p.Gradient*p.Gradient
+	mhat := m[0] / (1 - math.Pow(o.Beta1, float64(o.steps)))
+	vhat := m[1] / (1 - math.Pow(o.Beta2, float64(o.steps)))
+	p.Data += -o.rate * mhat / (math.Sqrt(vhat) + o.Epsilon)
+}
+
+// AdamW is Adam with weight decay decoupled from the gradient.
+// p = p - lr * weightdecay * p, followed by the Adam update
+// Only weights are decayed unless DecayBiases is set, as with Regularization.ExcludeBiases.
+type AdamW struct {
+	Adam
+	WeightDecay float64
+	DecayBiases bool // also decay biases and the scales and shifts of normalizations
+}
+
+// NewAdamW creates AdamW with the defaults of Adam and weight decay 0.01
+func NewAdamW(learnrate float64) *AdamW {
+	return &AdamW{Adam: *NewAdam(learnrate), WeightDecay: 0.01}
+}
+
+func (o *AdamW) Step(params []*Parameter) {
+	o.steps++
+	for _, p := range params {
+		if o.DecayBiases || p.Kind == ParameterWeight {
+			p.Data += -o.rate * o.WeightDecay * p.Data
+		}
+		o.update(p)
+	}
+}
@@ -0,0 +1,65 @@
+package network
+
+import (
+	"math"
+	"nn/network/exptree"
+	"testing"
+)
+
+func TestOptimizerSteps(t *testing.T) {
+	// every optimizer starts from 1 with learning rate 0.1 and sees the gradients 0.5 then -1
+	tests := []struct {
+		name      string
+		optimizer Optimizer
+		want      []float64
+	}{
+		{"sgd", NewSGD(0.1), []float64{0.95, 1.05}},
+		// v = 0.5, then 0.9 * 0.5 - 1 = -0.55
+		{"momentum", NewMomentum(0.1, 0.9), []float64{0.95, 1.005}},
+		// steps along 0.5 + 0.9 * 0.5 = 0.95, then -1 + 0.9 * -0.55 = -1.495
+		{"nesterov", NewNesterov(0.1, 0.9), []float64{0.905, 1.0545}},
+		// s = 0.25, then 1.25
+		{"adagrad", NewAdagrad(0.1), []float64{0.9, 0.9 + 0.1/math.Sqrt(1.25)}},
+		// s = 0.025, then 0.9 * 0.025 + 0.1 = 0.1225
+		{"rmsprop", NewRMSProp(0.1), []float64{1 - 0.05/math.Sqrt(0.025), 1 - 0.05/math.Sqrt(0.025) + 0.1/0.35}},
+		// the first step moves by the learning rate, then m = -0.055 and v = 0.00124975 before correction
+		{"adam", NewAdam(0.1), []float64{0.9, 0.9 + 0.1*(0.055/0.19)/math.Sqrt(0.00124975/(1-0.999*0.999))}},
+		// each step first shrinks the weight by 0.1 * 0.01 of itself
+		{"adamw", NewAdamW(0.1), []float64{0.899, 0.899*0.999 + 0.1*(0.055/0.19)/math.Sqrt(0.00124975/(1-0.999*0.999))}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Parameter{Node: exptree.NewNode("p", 1), Name: "p", Kind: ParameterWeight}
+			for i, gradient := range []float64{0.5, -1} {
+				p.Gradient = gradient
+				test.optimizer.Step([]*Parameter{p})
+				if math.Abs(p.Data-test.want[i]) > 1e-7 {
+					t.Fatalf("step %d moved the parameter to %.10g, want %.10g", i+1, p.Data, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAdamWDecaysWeightsOnly(t *testing.T) {
+	for _, decayBiases := range []bool{false, true} {
+		optimizer := NewAdamW(0.1)
+		optimizer.DecayBiases = decayBiases
+		weight := &Parameter{Node: exptree.NewNode("w", 1), Name: "w", Kind: ParameterWeight}
+		bias := &Parameter{Node: exptree.NewNode("b", 1), Name: "b", Kind: ParameterBias}
+		weight.Gradient, bias.Gradient = 0.5, 0.5
+		optimizer.Step([]*Parameter{weight, bias})
+
+		want := 0.9
+		if decayBiases {
+			want = 0.899
+		}
+		if math.Abs(weight.Data-0.899) > 1e-7 {
+			t.Fatalf("weight moved to %g, want 0.899", weight.Data)
+		}
+		if math.Abs(bias.Data-want) > 1e-7 {
+			t.Fatalf("bias moved to %g with DecayBiases %t, want %g", bias.Data, decayBiases, want)
+		}
+	}
+}
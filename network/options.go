@@ -0,0 +1,97 @@
+package network
+
+import "math/rand"
+
+// DefaultSeed seeds the source shared by the initializers and dropouts for which none is set with WithRand, see SeedDefault
+const DefaultSeed = 1
+
+// Options configures how neurons, layers and perceptrons are built.
+// Without options weights are drawn with XavierUniform and biases are 0. This replaces the former weights of 1 / inputs
+// and biases drawn from U(0, 1) by math/rand, so networks built without options start from other values than they used to.
+type Options struct {
+	Activation       string      // activation of every neuron, defaults to tanh
+	LayerActivations []string    // activation of each layer of a perceptron, by index. Takes precedence over `Activation`
+	Initializer      Initializer // initializer of the weights, defaults to XavierUniform
+	BiasInitializer  Initializer // initializer of the biases, defaults to Zeros
+	Rand             *rand.Rand  // source of the initializers, defaults to a source shared by the whole package, seeded with DefaultSeed
+	Normalizations   []string    // kind of normalization after each layer of a perceptron, by index. Empty for none
+	Dropout          []float64   // dropout rate after each layer of a perceptron, by index. 0 for none
+}
+
+// Option sets a field of Options
+type Option func(o *Options)
+
+// WithActivation sets the activation of every neuron built
+func WithActivation(name string) Option {
+	return func(o *Options) { o.Activation = name }
+}
+
+// WithLayerActivations sets the activation of each layer of a perceptron, in order.
+// Layers past the end of `names` use the activation set by WithActivation
+func WithLayerActivations(names ...string) Option {
+	return func(o *Options) { o.LayerActivations = names }
+}
+
+// WithInitializer sets the initializer of the weights
+func WithInitializer(initializer Initializer) Option {
+	return func(o *Options) { o.Initializer = initializer }
+}
+
+// WithBiasInitializer sets the initializer of the biases. The biases of a layer are drawn as a single column, i.e. with a fan in of 1
+func WithBiasInitializer(initializer Initializer) Option {
+	return func(o *Options) { o.BiasInitializer = initializer }
+}
+
+// WithRand sets the random source the initializers draw from. The same source is shared by all layers of a perceptron,
+// so building the same network with a source seeded alike gives the same weights.
+func WithRand(rng *rand.Rand) Option {
+	return func(o *Options) { o.Rand = rng }
+}
+
+// WithNormalization inserts normalization after the layers of a perceptron, `kinds` giving the kind after each layer in order,
+// NormalizationBatch, NormalizationLayer or empty for none.
+func WithNormalization(kinds ...string) Option {
+	return func(o *Options) { o.Normalizations = kinds }
+}
+
+// WithDropout inserts dropout after the layers of a perceptron, `rates` giving the rate after each layer in order.
+// A rate of 0 inserts none, so WithDropout(0.5, 0.5, 0) drops after the first two layers only.
+func WithDropout(rates ...float64) Option {
+	return func(o *Options) { o.Dropout = rates }
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		Activation:      ActivationTanh,
+		Initializer:     XavierUniform{},
+		BiasInitializer: Zeros{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Rand == nil {
+		o.Rand = rand.New(defaultSource)
+	}
+	return o
+}
+
+// initialize draws the weights and biases of `fanOut` neurons of `fanIn` inputs
+func (o *Options) initialize(fanIn, fanOut int) (weights [][]float64, biases []float64) {
+	weights = o.Initializer.Initialize(fanIn, fanOut, o.Rand)
+	for _, row := range o.BiasInitializer.Initialize(1, fanOut, o.Rand) {
+		biases = append(biases, row[0])
+	}
+	return weights, biases
+}
+
+// forLayer returns the options for the layer at `index` of a perceptron
+func (o *Options) forLayer(index int) Option {
+	layer := *o
+	if index < len(o.LayerActivations) && o.LayerActivations[index] != "" {
+		layer.Activation = o.LayerActivations[index]
+	}
+	layer.LayerActivations = nil
+	layer.Normalizations = nil
+	layer.Dropout = nil
+	return func(o *Options) { *o = layer }
+}
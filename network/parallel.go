@@ -0,0 +1,102 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"nn/network/exptree"
+	"sync"
+)
+
+// replicate returns `workers` copies of the module for data parallel training, or none for a single worker.
+// The copies are rebuilt from the JSON of the module, so custom modules must be registered with RegisterModule.
+// The dropouts of each copy draw from their own sources, seeded from those of the module, and the source shared by the package is left untouched.
+func (t *trainee) replicate(workers int) ([]*trainee, error) {
+	if workers <= 1 {
+		return nil, nil
+	}
+	replicas := []*trainee{}
+	for i := 0; i < workers; i++ {
+		replica, err := cloneModule(t.Module)
+		if err != nil {
+			return nil, fmt.Errorf("train: workers: %s", err)
+		}
+		originals := dropouts(t.Module)
+		for j, dropout := range dropouts(replica) {
+			dropout.Source = NewSource(originals[j].Rand.Int63())
+			dropout.Rand = rand.New(dropout.Source)
+		}
+		replicas = append(replicas, &trainee{Module: replica, label: t.label})
+	}
+	return replicas, nil
+}
+
+// parallelGradients sets the gradients of the parameters to those of the loss over a batch, returning the loss.
+//
+// The batch is split into contiguous shards, one per replica. Each replica first copies the data of the parameters,
+// then builds and backpropagates the graph of its shard on its own goroutine, so no node is written by two goroutines.
+// The gradients of the shards are then weighted by the share of the batch they hold, or not for losses reduced by sum,
+// and added up into the parameters in shard order, which keeps the result the same from run to run.
+// Buffers such as running averages are updated by each replica from those of the module, see UpdateRunningAverages,
+// and averaged back by the share of the batch.
+func (t *trainee) parallelGradients(config *trainConfig, batchx, batchy [][]*exptree.Node) float64 {
+	var (
+		params        = t.Parameters()
+		replicas      = config.replicas
+		shards        = len(replicas)
+		moduleBuffers = buffers(t.Module)
+		losses        = make([]float64, shards)
+		weights       = make([]float64, shards)
+		shares        = make([]float64, shards)
+		wg            = sync.WaitGroup{}
+	)
+	if len(batchx) < shards {
+		shards = len(batchx)
+	}
+
+	for k := 0; k < shards; k++ {
+		start, end := k*len(batchx)/shards, (k+1)*len(batchx)/shards
+		shares[k] = float64(end-start) / float64(len(batchx))
+		weights[k] = 1.0
+		if config.loss.Reduction() == ReduceMean {
+			weights[k] = shares[k]
+		}
+
+		for i, p := range replicas[k].Parameters() {
+			p.Data = params[i].Data
+		}
+		for i, buffer := range buffers(replicas[k].Module) {
+			copy(buffer, moduleBuffers[i])
+		}
+		setTraining(replicas[k].Module, isTraining(t.Module))
+
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			losses[k] = replicas[k].gradients(config, batchx[start:end], batchy[start:end])
+		}(k)
+	}
+	wg.Wait()
+	for k := 0; k < shards; k++ {
+		UpdateRunningAverages(replicas[k].Module)
+	}
+
+	for _, buffer := range moduleBuffers {
+		for j := range buffer {
+			buffer[j] = 0
+		}
+	}
+	t.ZeroGradient()
+	loss := 0.0
+	for k := 0; k < shards; k++ {
+		for i, p := range replicas[k].Parameters() {
+			params[i].Gradient += weights[k] * p.Gradient
+		}
+		for i, buffer := range buffers(replicas[k].Module) {
+			for j := range buffer {
+				moduleBuffers[i][j] += shares[k] * buffer[j]
+			}
+		}
+		loss += weights[k] * losses[k]
+	}
+	return loss
+}
@@ -0,0 +1,104 @@
+package network
+
+import (
+	"math"
+	"math/rand"
+	"nn/network/exptree"
+	"testing"
+)
+
+// trainWithWorkers trains a perceptron built from the same seed on the same data with `workers` workers
+func trainWithWorkers(t *testing.T, workers int) []*Parameter {
+	t.Helper()
+	x, y := [][]float64{}, [][]float64{}
+	rng := rand.New(NewSource(11))
+	for i := 0; i < 40; i++ {
+		a, b := rng.Float64()*2-1, rng.Float64()*2-1
+		x, y = append(x, []float64{a, b}), append(y, []float64{math.Sin(a) * b})
+	}
+
+	mlp := NewMultiLayerPerceptron("mlp", 2, []int{8, 4, 1}, WithRand(rand.New(NewSource(5))))
+	_, err := mlp.Train(15, 0.05, x, y,
+		WithBatchSize(10),
+		WithShuffle(rand.New(NewSource(7))),
+		WithOptimizer(NewAdam(0.01)),
+		WithWorkers(workers),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mlp.Parameters()
+}
+
+func TestTrainWithWorkers(t *testing.T) {
+	single := trainWithWorkers(t, 1)
+	for _, workers := range []int{2, 3, 4} {
+		params := trainWithWorkers(t, workers)
+		again := trainWithWorkers(t, workers)
+		for i := range single {
+			// the gradients of the shards are added up in another order than over the whole batch, so only the last bits may differ
+			if math.Abs(params[i].Data-single[i].Data) > 1e-9 {
+				t.Fatalf("%d workers: parameter `%s` is %g, want %g as with a single worker", workers, params[i].Name, params[i].Data, single[i].Data)
+			}
+			if params[i].Data != again[i].Data {
+				t.Fatalf("%d workers: parameter `%s` is %g then %g from run to run", workers, params[i].Name, params[i].Data, again[i].Data)
+			}
+		}
+	}
+}
+
+func TestReplicateKeepsDefaultSource(t *testing.T) {
+	rng := rand.New(NewSource(5))
+	model := NewSequential("model",
+		NewLayer("hidden", 2, 4, WithRand(rng)), NewDropout("dropout", 0.5, rand.New(NewSource(6))), NewLayer("out", 4, 1, WithRand(rng)))
+	before := defaultSource.source.State()
+	replicas, err := (&trainee{Module: model, label: model.Label}).replicate(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := defaultSource.source.State(); after != before {
+		t.Fatal("replicating a model drew from the source shared by the package")
+	}
+
+	// each replica masks differently from the others and from the model
+	masks := [][]float64{dropouts(model)[0].mask(16)}
+	for _, replica := range replicas {
+		masks = append(masks, dropouts(replica.Module)[0].mask(16))
+	}
+	for i := range masks {
+		for j := i + 1; j < len(masks); j++ {
+			if equalFloats(masks[i], masks[j]) {
+				t.Fatalf("dropouts %d and %d draw the same masks", i, j)
+			}
+		}
+	}
+}
+
+func TestBackPropagateParallelMLP(t *testing.T) {
+	// the layers compute their batches as tensors, so the parallel pass must run through their tensor computations
+	mlp := NewMultiLayerPerceptron("mlp", 3, []int{8, 8, 2}, WithRand(rand.New(NewSource(2))))
+	x, y := [][]float64{}, [][]float64{}
+	for i := 0; i < 6; i++ {
+		f := float64(i)
+		x, y = append(x, []float64{math.Sin(f), math.Cos(f), f / 6}), append(y, []float64{f / 6, -f / 6})
+	}
+	trainx, trainy := toNodes(x, y)
+	plan := exptree.NewPlan(mlp.Loss(MeanSquaredError{}, trainx, trainy))
+	params := mlp.Parameters()
+
+	plan.ZeroGradient()
+	plan.BackPropagate()
+	want := []float64{}
+	for _, p := range params {
+		want = append(want, p.Gradient)
+	}
+	for _, deterministic := range []bool{true, false} {
+		plan.ZeroGradient()
+		plan.BackPropagateParallel(4, deterministic)
+		for i, p := range params {
+			if math.Abs(p.Gradient-want[i]) > 1e-12*math.Max(1, math.Abs(want[i])) {
+				t.Fatalf("deterministic=%t: gradient of `%s` is %g, want %g", deterministic, p.Name, p.Gradient, want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package network
+
+import "nn/network/exptree"
+
+// ParameterKind is the role a trainable node plays in the network
+type ParameterKind string
+
+// ParameterWeight and ParameterBias are the kinds of parameters held by neurons
+const (
+	ParameterWeight ParameterKind = "weight"
+	ParameterBias   ParameterKind = "bias"
+)
+
+// Parameter is a trainable node of a network along with a stable name.
+// The node is embedded, so `Data` and `Gradient` can be accessed directly.
+type Parameter struct {
+	*exptree.Node
+	Name  string // unique within a network, e.g. `l0_n1_w2`
+	Layer string // label of the layer holding the parameter
+	Kind  ParameterKind
+}
+
+// uniqueParameters drops parameters whose node was already seen, keeping the first occurrence
+func uniqueParameters(params []*Parameter) []*Parameter {
+	seen := map[*exptree.Node]bool{}
+	unique := []*Parameter{}
+	for _, p := range params {
+		if seen[p.Node] {
+			continue
+		}
+		seen[p.Node] = true
+		unique = append(unique, p)
+	}
+	return unique
+}
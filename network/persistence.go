@@ -0,0 +1,536 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"nn/network/exptree"
+	"os"
+)
+
+// ModelFormatVersion is the version of the JSON written by Save
+const ModelFormatVersion = 1
+
+// ErrInvalidModel is wrapped by the errors returned when a saved model does not match the schema
+var ErrInvalidModel = errors.New("invalid model")
+
+// Save writes the mlp to `path` as versioned JSON, see WriteJSON
+func (mlp *MultiLayerPerceptron) Save(path string) error {
+	buf := bytes.Buffer{}
+	if err := mlp.WriteJSON(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// WriteJSON writes the output of ToJSONMap to `w`, along with the version of the format
+func (mlp *MultiLayerPerceptron) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"version": ModelFormatVersion,
+		"model":   mlp.ToJSONMap(),
+	})
+}
+
+// Load reads a mlp written by Save from `path`
+func Load(path string) (*MultiLayerPerceptron, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadJSON(f)
+}
+
+// ReadJSON reads a mlp written by WriteJSON from `r`, reconstructing its labels, weights, biases and activations.
+// Dropouts resume from the state of their source, those saved without one being seeded with DefaultSeed and their index.
+// Errors on a mismatch with the schema wrap ErrInvalidModel.
+func ReadJSON(r io.Reader) (*MultiLayerPerceptron, error) {
+	file := modelFile{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+	} else if file.Version != ModelFormatVersion {
+		return nil, fmt.Errorf("load: %w: unsupported version, want %d got %d", ErrInvalidModel, ModelFormatVersion, file.Version)
+	} else if file.Model == nil {
+		return nil, fmt.Errorf("load: %w: missing model", ErrInvalidModel)
+	}
+	return file.Model.build()
+}
+
+type modelFile struct {
+	Version int      `json:"version"`
+	Model   *mlpJSON `json:"model"`
+}
+
+type mlpJSON struct {
+	Type            string               `json:"type,omitempty"`
+	Name            string               `json:"name"`
+	LayerDimensions []int                `json:"layer_dimensions"`
+	Layers          []layerJSON          `json:"layers"`
+	Normalizations  []*normalizationJSON `json:"normalizations,omitempty"`
+	Dropout         []float64            `json:"dropout,omitempty"`
+	DropoutStates   []*uint64            `json:"dropout_states,omitempty"` // the state of the source of each dropout, null if it was not saved
+}
+
+type normalizationJSON struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Size        int       `json:"size"`
+	Gamma       []float64 `json:"gamma"`
+	Beta        []float64 `json:"beta"`
+	RunningMean []float64 `json:"running_mean,omitempty"`
+	RunningVar  []float64 `json:"running_var,omitempty"`
+	Momentum    float64   `json:"momentum,omitempty"`
+	Epsilon     float64   `json:"epsilon"`
+}
+
+type layerJSON struct {
+	Type          string       `json:"type,omitempty"`
+	Name          string       `json:"name"`
+	NumberInputs  int          `json:"number_inputs"`
+	NumberOutputs int          `json:"number_outputs"`
+	Neurons       []neuronJSON `json:"neurons"`
+}
+
+type neuronJSON struct {
+	Type          string    `json:"type,omitempty"`
+	Label         string    `json:"label"`
+	NumberInputs  int       `json:"number_inputs"`
+	NumberOutputs int       `json:"number_outputs"`
+	Weights       []float64 `json:"weights"`
+	Bias          *float64  `json:"bias"`
+	Activation    string    `json:"activation"`
+}
+
+func (m *mlpJSON) build() (*MultiLayerPerceptron, error) {
+	if len(m.LayerDimensions) < 2 {
+		return nil, fmt.Errorf("load: %w: want at least 2 layer dimensions, got %d", ErrInvalidModel, len(m.LayerDimensions))
+	} else if len(m.Layers) != len(m.LayerDimensions)-1 {
+		return nil, fmt.Errorf("load: %w: mismatch b/w layers and layer dimensions, want %d got %d", ErrInvalidModel, len(m.LayerDimensions)-1, len(m.Layers))
+	}
+
+	layers := []*Layer{}
+	for i := range m.Layers {
+		layer, err := m.Layers[i].build(m.LayerDimensions[i], m.LayerDimensions[i+1])
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	var normalizations []Normalization
+	if len(m.Normalizations) > 0 {
+		if len(m.Normalizations) != len(m.Layers) {
+			return nil, fmt.Errorf("load: %w: mismatch b/w normalizations and layers, want %d got %d", ErrInvalidModel, len(m.Layers), len(m.Normalizations))
+		}
+		normalizations = make([]Normalization, len(m.Layers))
+		for i, n := range m.Normalizations {
+			if n == nil {
+				continue
+			}
+			normalization, err := n.build(m.LayerDimensions[i+1])
+			if err != nil {
+				return nil, err
+			}
+			normalizations[i] = normalization
+		}
+	}
+
+	var dropouts []*Dropout
+	if len(m.Dropout) > 0 {
+		if len(m.Dropout) != len(m.Layers) {
+			return nil, fmt.Errorf("load: %w: mismatch b/w dropout rates and layers, want %d got %d", ErrInvalidModel, len(m.Layers), len(m.Dropout))
+		}
+		if len(m.DropoutStates) > 0 && len(m.DropoutStates) != len(m.Layers) {
+			return nil, fmt.Errorf("load: %w: mismatch b/w dropout states and layers, want %d got %d", ErrInvalidModel, len(m.Layers), len(m.DropoutStates))
+		}
+		dropouts = make([]*Dropout, len(m.Layers))
+		for i, rate := range m.Dropout {
+			if rate < 0 || rate >= 1 {
+				return nil, fmt.Errorf("load: %w: dropout rate %g of layer `%s` out of range [0, 1)", ErrInvalidModel, rate, m.Layers[i].Name)
+			} else if rate > 0 {
+				var state *uint64
+				if len(m.DropoutStates) > 0 {
+					state = m.DropoutStates[i]
+				}
+				dropouts[i] = restoreDropout(fmt.Sprintf("%s_dropout", m.Layers[i].Name), rate, state, DefaultSeed+int64(i))
+			}
+		}
+	}
+
+	return &MultiLayerPerceptron{
+		Label:          m.Name,
+		Layers:         layers,
+		Normalizations: normalizations,
+		Dropouts:       dropouts,
+		NumberInputs:   m.LayerDimensions[0],
+		NumberOutputs:  append([]int{}, m.LayerDimensions[1:]...),
+	}, nil
+}
+
+func (n *normalizationJSON) build(size int) (Normalization, error) {
+	if n.Size != size || len(n.Gamma) != size || len(n.Beta) != size {
+		return nil, fmt.Errorf("load: %w: normalization `%s` dimensions, want %d got %d with %d gamma and %d beta", ErrInvalidModel, n.Name, size, n.Size, len(n.Gamma), len(n.Beta))
+	}
+
+	var (
+		normalization Normalization
+		gamma, beta   []*exptree.Node
+	)
+	switch n.Type {
+	case NormalizationBatch:
+		if len(n.RunningMean) != size || len(n.RunningVar) != size {
+			return nil, fmt.Errorf("load: %w: normalization `%s` running averages, want %d got %d and %d", ErrInvalidModel, n.Name, size, len(n.RunningMean), len(n.RunningVar))
+		}
+		b := NewBatchNorm(n.Name, size)
+		copy(b.RunningMean, n.RunningMean)
+		copy(b.RunningVar, n.RunningVar)
+		b.Momentum, b.Epsilon = n.Momentum, n.Epsilon
+		normalization, gamma, beta = b, b.Gamma, b.Beta
+	case NormalizationLayer:
+		l := NewLayerNorm(n.Name, size)
+		l.Epsilon = n.Epsilon
+		normalization, gamma, beta = l, l.Gamma, l.Beta
+	default:
+		return nil, fmt.Errorf("load: %w: normalization `%s`: unknown normalization `%s`", ErrInvalidModel, n.Name, n.Type)
+	}
+
+	for j := 0; j < size; j++ {
+		gamma[j].Data, beta[j].Data = n.Gamma[j], n.Beta[j]
+	}
+	return normalization, nil
+}
+
+func (l *layerJSON) build(numInputs, numOutputs int) (*Layer, error) {
+	if l.NumberInputs != numInputs || l.NumberOutputs != numOutputs {
+		return nil, fmt.Errorf("load: %w: layer `%s` dimensions, want %dx%d got %dx%d", ErrInvalidModel, l.Name, numInputs, numOutputs, l.NumberInputs, l.NumberOutputs)
+	} else if len(l.Neurons) != numOutputs {
+		return nil, fmt.Errorf("load: %w: layer `%s` neurons, want %d got %d", ErrInvalidModel, l.Name, numOutputs, len(l.Neurons))
+	}
+
+	neurons := []*Neuron{}
+	for i := range l.Neurons {
+		neuron, err := l.Neurons[i].build(numInputs)
+		if err != nil {
+			return nil, err
+		}
+		neurons = append(neurons, neuron)
+	}
+
+	return &Layer{
+		Label:         l.Name,
+		Neurons:       neurons,
+		NumberInputs:  numInputs,
+		NumberOutputs: numOutputs,
+	}, nil
+}
+
+func (n *neuronJSON) build(numInputs int) (*Neuron, error) {
+	if n.NumberInputs != numInputs || len(n.Weights) != numInputs {
+		return nil, fmt.Errorf("load: %w: neuron `%s` weights, want %d got %d", ErrInvalidModel, n.Label, numInputs, len(n.Weights))
+	} else if n.NumberOutputs != 1 {
+		return nil, fmt.Errorf("load: %w: neuron `%s` outputs, want 1 got %d", ErrInvalidModel, n.Label, n.NumberOutputs)
+	} else if n.Bias == nil {
+		return nil, fmt.Errorf("load: %w: neuron `%s` has no bias", ErrInvalidModel, n.Label)
+	}
+
+	activation, err := GetActivation(n.Activation)
+	if err != nil {
+		return nil, fmt.Errorf("load: %w: neuron `%s`: %s", ErrInvalidModel, n.Label, err)
+	}
+	return newNeuronFromValues(n.Label, n.Weights, *n.Bias, activation), nil
+}
+
+// moduleDecoders rebuild modules from their JSON by type, see RegisterModule
+var moduleDecoders = map[string]func(data []byte) (Module, error){}
+
+func init() {
+	RegisterModule(ModuleNeuron, func(data []byte) (Module, error) {
+		n := neuronJSON{}
+		if err := decodeStrict(data, &n); err != nil {
+			return nil, err
+		}
+		neuron, err := n.build(n.NumberInputs)
+		if err != nil {
+			return nil, err
+		}
+		return neuron.AsModule(), nil
+	})
+	RegisterModule(ModuleLayer, func(data []byte) (Module, error) {
+		l := layerJSON{}
+		if err := decodeStrict(data, &l); err != nil {
+			return nil, err
+		}
+		return l.build(l.NumberInputs, l.NumberOutputs)
+	})
+	RegisterModule(ModulePerceptron, func(data []byte) (Module, error) {
+		m := mlpJSON{}
+		if err := decodeStrict(data, &m); err != nil {
+			return nil, err
+		}
+		return m.build()
+	})
+	RegisterModule(ModuleSequential, func(data []byte) (Module, error) {
+		s := sequentialJSON{}
+		if err := decodeStrict(data, &s); err != nil {
+			return nil, err
+		}
+		return s.build()
+	})
+	RegisterModule(ModuleGraph, func(data []byte) (Module, error) {
+		g := graphJSON{}
+		if err := decodeStrict(data, &g); err != nil {
+			return nil, err
+		}
+		return g.build()
+	})
+	RegisterModule(ModuleConv1D, func(data []byte) (Module, error) {
+		c := conv1dJSON{}
+		if err := decodeStrict(data, &c); err != nil {
+			return nil, err
+		}
+		return c.build()
+	})
+	decodePool := func(data []byte) (Module, error) {
+		p := pool1dJSON{}
+		if err := decodeStrict(data, &p); err != nil {
+			return nil, err
+		}
+		pool, err := newPool1D(p.Type, p.Name, p.Channels, p.Length, p.KernelSize, p.Stride, p.Padding)
+		if err != nil {
+			return nil, fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+		}
+		return pool, nil
+	}
+	RegisterModule(ModuleMaxPool1D, decodePool)
+	RegisterModule(ModuleAvgPool1D, decodePool)
+	RegisterModule(ModuleDropout, func(data []byte) (Module, error) {
+		d := dropoutJSON{}
+		if err := decodeStrict(data, &d); err != nil {
+			return nil, err
+		} else if d.Rate < 0 || d.Rate >= 1 {
+			return nil, fmt.Errorf("load: %w: dropout `%s` rate %g out of range [0, 1)", ErrInvalidModel, d.Name, d.Rate)
+		}
+		return restoreDropout(d.Name, d.Rate, d.State, DefaultSeed), nil
+	})
+	decodeNormalization := func(data []byte) (Module, error) {
+		n := normalizationJSON{}
+		if err := decodeStrict(data, &n); err != nil {
+			return nil, err
+		}
+		return n.build(n.Size)
+	}
+	RegisterModule(NormalizationBatch, decodeNormalization)
+	RegisterModule(NormalizationLayer, decodeNormalization)
+}
+
+// RegisterModule registers how to rebuild modules whose ToJSONMap holds `kind` under "type", replacing any existing one.
+// `decode` receives the JSON of the map. Modules must be registered to be loaded with ReadModuleJSON, and to be trained with WithWorkers.
+func RegisterModule(kind string, decode func(data []byte) (Module, error)) {
+	moduleDecoders[kind] = decode
+}
+
+// SaveModule writes `m` to `path` as versioned JSON, see WriteModuleJSON
+func SaveModule(path string, m Module) error {
+	buf := bytes.Buffer{}
+	if err := WriteModuleJSON(&buf, m); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// WriteModuleJSON writes the output of the ToJSONMap of `m` to `w`, along with the version of the format
+func WriteModuleJSON(w io.Writer, m Module) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"version": ModelFormatVersion,
+		"model":   m.ToJSONMap(),
+	})
+}
+
+// LoadModule reads a module written by SaveModule from `path`
+func LoadModule(path string) (Module, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadModuleJSON(f)
+}
+
+// ReadModuleJSON reads a module written by WriteModuleJSON, or a mlp written by WriteJSON, from `r`.
+// The module is rebuilt by the decoder registered for its type, a model without a type being a mlp.
+// Errors on a mismatch with the schema wrap ErrInvalidModel.
+func ReadModuleJSON(r io.Reader) (Module, error) {
+	file := struct {
+		Version int             `json:"version"`
+		Model   json.RawMessage `json:"model"`
+	}{}
+	if err := decodeStrictReader(r, &file); err != nil {
+		return nil, err
+	} else if file.Version != ModelFormatVersion {
+		return nil, fmt.Errorf("load: %w: unsupported version, want %d got %d", ErrInvalidModel, ModelFormatVersion, file.Version)
+	} else if len(file.Model) == 0 || string(file.Model) == "null" {
+		return nil, fmt.Errorf("load: %w: missing model", ErrInvalidModel)
+	}
+	return decodeModule(file.Model)
+}
+
+// decodeModule rebuilds a module from its JSON with the decoder registered for its type
+func decodeModule(data []byte) (Module, error) {
+	header := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+	} else if header.Type == "" {
+		header.Type = ModulePerceptron
+	}
+	decode, ok := moduleDecoders[header.Type]
+	if !ok {
+		return nil, fmt.Errorf("load: %w: unknown module type `%s`", ErrInvalidModel, header.Type)
+	}
+	return decode(data)
+}
+
+type sequentialJSON struct {
+	Type    string            `json:"type"`
+	Name    string            `json:"name"`
+	Modules []json.RawMessage `json:"modules"`
+}
+
+func (s *sequentialJSON) build() (m Module, err error) {
+	modules := []Module{}
+	for _, data := range s.Modules {
+		module, err := decodeModule(data)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, module)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, fmt.Errorf("load: %w: %v", ErrInvalidModel, r)
+		}
+	}()
+	return NewSequential(s.Name, modules...), nil
+}
+
+type graphJSON struct {
+	Type    string           `json:"type"`
+	Name    string           `json:"name"`
+	Inputs  []graphInputJSON `json:"inputs"`
+	Nodes   []graphNodeJSON  `json:"nodes"`
+	Outputs []string         `json:"outputs"`
+}
+
+type graphInputJSON struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+type graphNodeJSON struct {
+	Name     string          `json:"name"`
+	Module   json.RawMessage `json:"module"`
+	From     []string        `json:"from"`
+	Merge    string          `json:"merge"`
+	Residual bool            `json:"residual"`
+}
+
+func (g *graphJSON) build() (*Graph, error) {
+	inputs := []GraphInput{}
+	for _, input := range g.Inputs {
+		inputs = append(inputs, GraphInput{Name: input.Name, Size: input.Size})
+	}
+	nodes := []GraphNode{}
+	for _, node := range g.Nodes {
+		var module Module
+		if len(node.Module) > 0 && string(node.Module) != "null" {
+			m, err := decodeModule(node.Module)
+			if err != nil {
+				return nil, err
+			}
+			module = m
+		}
+		nodes = append(nodes, GraphNode{Name: node.Name, Module: module, From: node.From, Merge: node.Merge, Residual: node.Residual})
+	}
+
+	graph, err := NewGraph(g.Name, inputs, nodes, g.Outputs)
+	if err != nil {
+		return nil, fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+	}
+	return graph, nil
+}
+
+type conv1dJSON struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	InChannels  int       `json:"in_channels"`
+	OutChannels int       `json:"out_channels"`
+	Length      int       `json:"length"`
+	KernelSize  int       `json:"kernel_size"`
+	Stride      int       `json:"stride"`
+	Padding     int       `json:"padding"`
+	Dilation    int       `json:"dilation"`
+	Kernel      layerJSON `json:"kernel"`
+}
+
+func (c *conv1dJSON) build() (*Conv1D, error) {
+	kernel, err := c.Kernel.build(c.InChannels*c.KernelSize, c.OutChannels)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := newConv1D(c.Name, kernel, c.InChannels, c.Length, c.KernelSize, c.Stride, c.Padding, c.Dilation)
+	if err != nil {
+		return nil, fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+	}
+	return conv, nil
+}
+
+type pool1dJSON struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Channels   int    `json:"channels"`
+	Length     int    `json:"length"`
+	KernelSize int    `json:"kernel_size"`
+	Stride     int    `json:"stride"`
+	Padding    int    `json:"padding"`
+}
+
+type dropoutJSON struct {
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Rate  float64 `json:"rate"`
+	State *uint64 `json:"state,omitempty"`
+}
+
+// decodeStrict decodes `data` into `v`, erroring on unknown fields
+func decodeStrict(data []byte, v any) error {
+	return decodeStrictReader(bytes.NewReader(data), v)
+}
+
+func decodeStrictReader(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("load: %w: %s", ErrInvalidModel, err)
+	}
+	return nil
+}
+
+// cloneModule builds an identical copy of `m` holding its own nodes, by going through its JSON representation.
+// Decoding never draws from the source shared by the package, so cloning leaves it as it was.
+func cloneModule(m Module) (Module, error) {
+	buf := bytes.Buffer{}
+	if err := WriteModuleJSON(&buf, m); err != nil {
+		return nil, err
+	}
+	return ReadModuleJSON(&buf)
+}
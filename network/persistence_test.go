@@ -0,0 +1,98 @@
+package network
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	mlp := NewMultiLayerPerceptron("mlp", 3, []int{4, 2}, WithRand(rand.New(NewSource(3))), WithLayerActivations(ActivationReLU, ActivationSigmoid))
+	path := filepath.Join(t.TempDir(), "mlp.json")
+	if err := mlp.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, got := mlp.Parameters(), loaded.Parameters()
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d parameters, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Data != want[i].Data {
+			t.Fatalf("parameter %d loaded as `%s` = %g, want `%s` = %g", i, got[i].Name, got[i].Data, want[i].Name, want[i].Data)
+		}
+	}
+	for _, in := range [][]float64{{0.1, -0.4, 0.9}, {-1, 2, 0.5}} {
+		want, got := mlp.Predict(in), loaded.Predict(in)
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("loaded model predicts %v for %v, want %v", got, in, want)
+			}
+		}
+	}
+}
+
+func TestLoadDropoutState(t *testing.T) {
+	// models built from different seeds must not load with the same masks, and a loaded model draws the masks the saved one would have
+	build := func(seed int64) *MultiLayerPerceptron {
+		mlp := NewMultiLayerPerceptron("mlp", 3, []int{8, 2}, WithRand(rand.New(NewSource(seed))), WithDropout(0.5))
+		mlp.Dropouts[0].mask(5)
+		return mlp
+	}
+	saved := []*MultiLayerPerceptron{build(1), build(2)}
+	loaded := []*MultiLayerPerceptron{}
+	for i, mlp := range saved {
+		path := filepath.Join(t.TempDir(), "mlp.json")
+		if err := mlp.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := m.Dropouts[0].mask(16), mlp.Dropouts[0].mask(16); !equalFloats(got, want) {
+			t.Fatalf("model %d: loaded dropout draws %v, want %v", i, got, want)
+		}
+		loaded = append(loaded, m)
+	}
+	if equalFloats(loaded[0].Dropouts[0].mask(16), loaded[1].Dropouts[0].mask(16)) {
+		t.Fatal("models built from different seeds load with the same masks")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name, json string
+	}{
+		{"version", `{"version": 2, "model": {"name": "mlp", "layer_dimensions": [1, 1], "layers": []}}`},
+		{"missing model", `{"version": 1}`},
+		{"layers", `{"version": 1, "model": {"name": "mlp", "layer_dimensions": [1, 1], "layers": []}}`},
+		{"unknown field", `{"version": 1, "model": {"name": "mlp", "layer_dimensions": [1, 1], "layers": [], "extra": 1}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadJSON(strings.NewReader(test.json)); !errors.Is(err, ErrInvalidModel) {
+				t.Fatalf("error %v, want ErrInvalidModel", err)
+			}
+		})
+	}
+}
+
+// equalFloats tells whether `a` and `b` hold the same values
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+)
+
+// Predict computes the output of the neuron for `input` from the data of its weights, without building an expression tree.
+// `input` should have len `Neuron.NumberInputs`, or will panic
+func (n *Neuron) Predict(input []float64) float64 {
+	if len(input) != n.NumberInputs {
+		panic(fmt.Sprintf("mismatch in input dimensions: want %d, got %d", n.NumberInputs, len(input)))
+	}
+
+	sum := 0.0
+	for i := range input {
+		sum += input[i] * n.Weights[i].Data
+	}
+	return n.Activation.Eval(sum + n.Bias.Data)
+}
+
+// Predict computes the output of the layer for `input`, without building an expression tree
+func (l *Layer) Predict(input []float64) []float64 {
+	output := make([]float64, len(l.Neurons))
+	for i, neuron := range l.Neurons {
+		output[i] = neuron.Predict(input)
+	}
+	return output
+}
+
+// Predict computes the output of the mlp for `input` from the data of its weights, without building an expression tree.
+// Meant for inference, where gradients are never needed, so dropout is skipped and batch normalization uses its running averages whatever the mode of the mlp.
+func (mlp *MultiLayerPerceptron) Predict(input []float64) []float64 {
+	buf := input
+	for i := range mlp.Layers {
+		buf = mlp.Layers[i].Predict(buf)
+		if normalization := mlp.normalization(i); normalization != nil {
+			buf = normalization.Predict(buf)
+		}
+	}
+	return buf
+}
+
+// PredictBatch computes the output of the mlp for each row of `inputs`, see Predict
+func (mlp *MultiLayerPerceptron) PredictBatch(inputs [][]float64) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+	for i := range inputs {
+		outputs[i] = mlp.Predict(inputs[i])
+	}
+	return outputs
+}
+
+// Eval applies the activation to a plain value. Activations registered with RegisterActivation have no function
+// to evaluate directly, so a throwaway node is built for them.
+func (a *Activation) Eval(x float64) float64 {
+	if a.Elementwise != nil {
+		return a.Elementwise.Fn(x)
+	}
+	return a.Apply(a.Name, exptree.NewConstant(a.Name, x)).Data
+}
@@ -0,0 +1,78 @@
+package network
+
+import "sync"
+
+// Source is a splitmix64 random source whose whole state is a single uint64, so it can be checkpointed.
+// It implements rand.Source64, use rand.New(NewSource(seed)) to get a *rand.Rand.
+type Source struct {
+	state uint64
+}
+
+// NewSource creates a source seeded with `seed`
+func NewSource(seed int64) *Source {
+	s := &Source{}
+	s.Seed(seed)
+	return s
+}
+
+// Seed resets the source to the sequence of `seed`
+func (s *Source) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns the next pseudo random uint64
+func (s *Source) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns the next pseudo random non negative int64
+func (s *Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// State returns the current state of the source
+func (s *Source) State() uint64 {
+	return s.state
+}
+
+// SetState restores a state returned by State
+func (s *Source) SetState(state uint64) {
+	s.state = state
+}
+
+// defaultSource is the source of the constructors called without WithRand, seeded with DefaultSeed.
+// It advances from one call to the next so models built alike get different weights.
+var defaultSource = &lockedSource{source: NewSource(DefaultSeed)}
+
+// SeedDefault reseeds the source used when none is set with WithRand, e.g. to build the same models again
+func SeedDefault(seed int64) {
+	defaultSource.Seed(seed)
+}
+
+// lockedSource is a source safe for concurrent use
+type lockedSource struct {
+	mu     sync.Mutex
+	source *Source
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source.Seed(seed)
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Uint64()
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Int63()
+}
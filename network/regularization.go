@@ -0,0 +1,68 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+)
+
+// Penalty is a pair of coefficients of an elastic net penalty.
+// for a parameter w
+// penalty = L1 * |w| + L2 * w ^ 2
+type Penalty struct {
+	L1 float64
+	L2 float64
+}
+
+// Regularization adds a penalty on the parameters to the loss, so their gradients pull the weights towards zero, see WithRegularization
+type Regularization struct {
+	Penalty                          // coefficients of the layers missing from Layers
+	Layers        map[string]Penalty // coefficients by layer label
+	ExcludeBiases bool               // only penalize weights, leaving out biases and the scales and shifts of normalizations
+}
+
+// L1 penalizes the absolute value of every parameter, pushing weights to exactly zero
+func L1(coefficient float64) Regularization {
+	return Regularization{Penalty: Penalty{L1: coefficient}}
+}
+
+// L2 penalizes the square of every parameter, also known as weight decay
+func L2(coefficient float64) Regularization {
+	return Regularization{Penalty: Penalty{L2: coefficient}}
+}
+
+// ElasticNet penalizes both the absolute value and the square of every parameter
+func ElasticNet(l1, l2 float64) Regularization {
+	return Regularization{Penalty: Penalty{L1: l1, L2: l2}}
+}
+
+// penaltyFor returns the coefficients applied to `p`
+func (r Regularization) penaltyFor(p *Parameter) Penalty {
+	if penalty, ok := r.Layers[p.Layer]; ok {
+		return penalty
+	}
+	return r.Penalty
+}
+
+// Node builds the penalty over `params` as a single node, so its gradient flows to the parameters through BackPropagate.
+// A node of 0 is returned when no parameter is penalized.
+func (r Regularization) Node(label string, params []*Parameter) *exptree.Node {
+	terms := []*exptree.Node{}
+	for _, p := range params {
+		if r.ExcludeBiases && p.Kind != ParameterWeight {
+			continue
+		}
+		penalty := r.penaltyFor(p)
+		if penalty.L1 != 0 {
+			abs := exptree.Abs(fmt.Sprintf("%s_%s_abs", label, p.Name), p.Node)
+			terms = append(terms, exptree.Multiply(fmt.Sprintf("%s_%s_l1", label, p.Name), exptree.NewConstant(label+"_l1_coefficient", penalty.L1), abs))
+		}
+		if penalty.L2 != 0 {
+			square := exptree.Power(fmt.Sprintf("%s_%s_square", label, p.Name), exptree.NewConstant(label+"_two", 2), p.Node)
+			terms = append(terms, exptree.Multiply(fmt.Sprintf("%s_%s_l2", label, p.Name), exptree.NewConstant(label+"_l2_coefficient", penalty.L2), square))
+		}
+	}
+	if len(terms) == 0 {
+		return exptree.NewConstant(label, 0)
+	}
+	return exptree.Add(label, terms...)
+}
@@ -0,0 +1,154 @@
+package network
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scheduler decides the learning rate of each training cycle
+type Scheduler interface {
+	// LearningRate returns the learning rate to use for `epoch` given the `initial` learning rate passed to Train
+	// and `loss`, the data of the loss node of the previous epoch. `loss` is NaN for the first epoch.
+	LearningRate(epoch int, initial float64, loss float64) float64
+}
+
+// StatefulScheduler is a scheduler whose learning rate depends on the past epochs, its state being saved by checkpoints
+type StatefulScheduler interface {
+	Scheduler
+	// State returns a copy of what the scheduler learned from the past epochs
+	State() []float64
+	// SetState restores a state returned by State
+	SetState(state []float64) error
+}
+
+// StepDecay multiplies the learning rate by `Gamma` every `StepSize` epochs
+type StepDecay struct {
+	StepSize int
+	Gamma    float64
+}
+
+func (s *StepDecay) LearningRate(epoch int, initial float64, loss float64) float64 {
+	if s.StepSize <= 0 {
+		return initial
+	}
+	return initial * math.Pow(s.Gamma, float64(epoch/s.StepSize))
+}
+
+// ExponentialDecay multiplies the learning rate by `Gamma` every epoch
+type ExponentialDecay struct {
+	Gamma float64
+}
+
+func (s *ExponentialDecay) LearningRate(epoch int, initial float64, loss float64) float64 {
+	return initial * math.Pow(s.Gamma, float64(epoch))
+}
+
+// CosineAnnealing anneals the learning rate from the initial one down to `MinLearningRate` along half a cosine over `Period` epochs.
+// The learning rate stays at `MinLearningRate` past the period.
+type CosineAnnealing struct {
+	Period          int
+	MinLearningRate float64
+}
+
+func (s *CosineAnnealing) LearningRate(epoch int, initial float64, loss float64) float64 {
+	if s.Period <= 0 || epoch >= s.Period {
+		return s.MinLearningRate
+	}
+	return s.MinLearningRate + (initial-s.MinLearningRate)*(1+math.Cos(math.Pi*float64(epoch)/float64(s.Period)))/2
+}
+
+// LinearWarmup ramps the learning rate linearly from `StartFactor` * initial up to initial over `Epochs` epochs.
+// After the warmup `Then` takes over, counting epochs from the end of the warmup, or the initial learning rate is kept if it is nil.
+type LinearWarmup struct {
+	Epochs      int
+	StartFactor float64
+	Then        Scheduler
+}
+
+func (s *LinearWarmup) LearningRate(epoch int, initial float64, loss float64) float64 {
+	if epoch < s.Epochs {
+		return initial * (s.StartFactor + (1-s.StartFactor)*float64(epoch)/float64(s.Epochs))
+	}
+	if s.Then == nil {
+		return initial
+	}
+	return s.Then.LearningRate(epoch-s.Epochs, initial, loss)
+}
+
+// State returns the state of `Then`, if it is a StatefulScheduler
+func (s *LinearWarmup) State() []float64 {
+	if then, ok := s.Then.(StatefulScheduler); ok {
+		return then.State()
+	}
+	return nil
+}
+
+// SetState restores the state of `Then`, if it is a StatefulScheduler
+func (s *LinearWarmup) SetState(state []float64) error {
+	if then, ok := s.Then.(StatefulScheduler); ok {
+		return then.SetState(state)
+	} else if len(state) > 0 {
+		return fmt.Errorf("scheduler: warmup has no state to restore")
+	}
+	return nil
+}
+
+// ReduceOnPlateau multiplies the learning rate by `Factor` once the loss has not improved by more than `MinDelta`
+// for more than `Patience` epochs, never going below `MinLearningRate`.
+type ReduceOnPlateau struct {
+	Factor          float64
+	Patience        int
+	MinDelta        float64
+	MinLearningRate float64
+
+	initialized bool // set by the first epoch, which starts from the initial learning rate
+	current     float64
+	best        float64
+	wait        int
+}
+
+// NewReduceOnPlateau creates a ReduceOnPlateau scheduler
+func NewReduceOnPlateau(factor float64, patience int) *ReduceOnPlateau {
+	return &ReduceOnPlateau{Factor: factor, Patience: patience}
+}
+
+func (s *ReduceOnPlateau) LearningRate(epoch int, initial float64, loss float64) float64 {
+	if !s.initialized {
+		s.initialized, s.current, s.best = true, initial, math.Inf(1)
+	}
+	if math.IsNaN(loss) {
+		return s.current
+	}
+
+	if loss < s.best-s.MinDelta {
+		s.best, s.wait = loss, 0
+		return s.current
+	}
+
+	s.wait++
+	if s.wait > s.Patience {
+		s.current, s.wait = math.Max(s.current*s.Factor, s.MinLearningRate), 0
+	}
+	return s.current
+}
+
+// State returns the current learning rate, the best loss and the epochs waited since, or nothing before the first epoch
+func (s *ReduceOnPlateau) State() []float64 {
+	if !s.initialized {
+		return []float64{}
+	}
+	return []float64{s.current, s.best, float64(s.wait)}
+}
+
+// SetState restores a state returned by State
+func (s *ReduceOnPlateau) SetState(state []float64) error {
+	if len(state) == 0 {
+		s.initialized, s.current, s.best, s.wait = false, 0, 0, 0
+		return nil
+	}
+	if len(state) != 3 {
+		return fmt.Errorf("scheduler: reduce on plateau state has %d values, want 3", len(state))
+	}
+	s.initialized, s.current, s.best, s.wait = true, state[0], state[1], int(state[2])
+	return nil
+}
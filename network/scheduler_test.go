@@ -0,0 +1,61 @@
+package network
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedulers(t *testing.T) {
+	tests := []struct {
+		name      string
+		scheduler Scheduler
+		want      []float64 // learning rates of the first epochs, starting from 1
+	}{
+		{"step decay", &StepDecay{StepSize: 2, Gamma: 0.5}, []float64{1, 1, 0.5, 0.5, 0.25}},
+		{"step decay without steps", &StepDecay{Gamma: 0.5}, []float64{1, 1, 1}},
+		{"exponential decay", &ExponentialDecay{Gamma: 0.5}, []float64{1, 0.5, 0.25, 0.125}},
+		// half a cosine from 1 down to 0.2 over 4 epochs, then staying at 0.2
+		{"cosine annealing", &CosineAnnealing{Period: 4, MinLearningRate: 0.2},
+			[]float64{1, 0.2 + 0.4*(1+math.Sqrt2/2), 0.6, 0.2 + 0.4*(1-math.Sqrt2/2), 0.2, 0.2}},
+		{"linear warmup", &LinearWarmup{Epochs: 4, StartFactor: 0.2}, []float64{0.2, 0.4, 0.6, 0.8, 1, 1}},
+		// the decay counts epochs from the end of the warmup
+		{"linear warmup then decay", &LinearWarmup{Epochs: 2, StartFactor: 0.5, Then: &ExponentialDecay{Gamma: 0.5}},
+			[]float64{0.5, 0.75, 1, 0.5, 0.25}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for epoch, want := range test.want {
+				if got := test.scheduler.LearningRate(epoch, 1, math.NaN()); math.Abs(got-want) > 1e-12 {
+					t.Fatalf("learning rate of epoch %d is %g, want %g", epoch, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := NewReduceOnPlateau(0.5, 1)
+	s.MinDelta = 0.01
+	// the first epoch has no loss, the second improves, then the loss stalls within MinDelta
+	losses := []float64{math.NaN(), 1, 0.995, 0.999, 0.5, 0.6, 0.7, 0.8, 0.9}
+	want := []float64{1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.125}
+	for epoch, loss := range losses {
+		if got := s.LearningRate(epoch, 1, loss); got != want[epoch] {
+			t.Fatalf("learning rate of epoch %d is %g, want %g", epoch, got, want[epoch])
+		}
+	}
+}
+
+func TestReduceOnPlateauDownToZero(t *testing.T) {
+	// a learning rate reduced to zero must not be taken for an unstarted scheduler and reset to the initial one
+	s := NewReduceOnPlateau(0, 0)
+	s.LearningRate(0, 1, math.NaN())
+	s.LearningRate(1, 1, 1)
+	if got := s.LearningRate(2, 1, 2); got != 0 {
+		t.Fatalf("learning rate after the plateau is %g, want 0", got)
+	}
+	if got := s.LearningRate(3, 1, 3); got != 0 {
+		t.Fatalf("learning rate after reaching 0 is %g, want it to stay 0", got)
+	}
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"fmt"
+	"nn/network/exptree"
+)
+
+// Sequential chains modules, the outputs of each module being the inputs of the next.
+// It is itself a module, so sequentials can be nested and mixed with any other module.
+type Sequential struct {
+	Label   string
+	Modules []Module
+
+	training bool
+}
+
+// NewSequential chains `modules` in order.
+// Panics if a Sized module does not take as many inputs as the last Sized module before it gives outputs.
+func NewSequential(label string, modules ...Module) *Sequential {
+	outputs, from := -1, ""
+	for i, m := range modules {
+		sized, ok := m.(Sized)
+		if !ok {
+			continue
+		}
+		if in := sized.InputSize(); in >= 0 && outputs >= 0 && in != outputs {
+			panic(fmt.Sprintf("mismatch in sequential `%s` dimensions: module %d (%T) wants %d inputs, %s gives %d", label, i, m, in, from, outputs))
+		}
+		if out := sized.OutputSize(); out >= 0 {
+			outputs, from = out, fmt.Sprintf("module %d (%T)", i, m)
+		}
+	}
+	return &Sequential{Label: label, Modules: modules}
+}
+
+// Forwards returns the outputs of the last module for the single row `in`, see ForwardsBatch
+func (s *Sequential) Forwards(in []*exptree.Node) []*exptree.Node {
+	return s.ForwardsBatch([][]*exptree.Node{in})[0]
+}
+
+// ForwardsBatch returns the outputs of the last module for each row of `in`.
+// BatchModule modules see the whole batch at once, the others each row in turn.
+func (s *Sequential) ForwardsBatch(in [][]*exptree.Node) [][]*exptree.Node {
+	buf := in
+	for _, m := range s.Modules {
+		buf = forwardsBatch(m, buf)
+	}
+	return buf
+}
+
+// ForwardsTensor returns the outputs of the last module for a whole batch `in` of shape [batch, inputs].
+// Panics if a module is not a TensorModule.
+func (s *Sequential) ForwardsTensor(in *exptree.Tensor) *exptree.Tensor {
+	buf := in
+	for _, m := range s.Modules {
+		buf = forwardsTensor(m, buf)
+	}
+	return buf
+}
+
+// Predict computes the outputs of the last module for `in`, as in inference mode, without building an expression tree
+// for the modules that are Predictor
+func (s *Sequential) Predict(in []float64) []float64 {
+	buf := in
+	for _, m := range s.Modules {
+		buf = predict(m, buf)
+	}
+	return buf
+}
+
+// PredictBatch computes the outputs for each row of `inputs`, see Predict
+func (s *Sequential) PredictBatch(inputs [][]float64) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+	for i := range inputs {
+		outputs[i] = s.Predict(inputs[i])
+	}
+	return outputs
+}
+
+// Parameters returns the parameters of all modules in order, every trainable node appearing exactly once
+func (s *Sequential) Parameters() []*Parameter {
+	params := []*Parameter{}
+	for _, m := range s.Modules {
+		params = append(params, m.Parameters()...)
+	}
+	return uniqueParameters(params)
+}
+
+// ZeroGradient sets the gradients of all parameters to 0
+func (s *Sequential) ZeroGradient() {
+	zeroGradient(s.Parameters())
+}
+
+// SetTraining switches all modules to training mode or to inference mode.
+// A new sequential is in inference mode; Train switches to training mode for its duration.
+func (s *Sequential) SetTraining(training bool) {
+	s.training = training
+	for _, m := range s.Modules {
+		setTraining(m, training)
+	}
+}
+
+// Training returns whether the sequential is in training mode, see SetTraining
+func (s *Sequential) Training() bool {
+	return s.training
+}
+
+// InputSize returns the number of inputs of the first Sized module, -1 if there is none
+func (s *Sequential) InputSize() int {
+	for _, m := range s.Modules {
+		if sized, ok := m.(Sized); ok {
+			return sized.InputSize()
+		}
+	}
+	return -1
+}
+
+// OutputSize returns the number of outputs of the last Sized module, -1 if there is none
+func (s *Sequential) OutputSize() int {
+	for i := len(s.Modules) - 1; i >= 0; i-- {
+		if sized, ok := s.Modules[i].(Sized); ok {
+			return sized.OutputSize()
+		}
+	}
+	return -1
+}
+
+func (s *Sequential) ToJSONMap() map[string]any {
+	modules := []map[string]any{}
+	for _, m := range s.Modules {
+		modules = append(modules, m.ToJSONMap())
+	}
+	return map[string]any{
+		"type":    ModuleSequential,
+		"name":    s.Label,
+		"modules": modules,
+	}
+}
+
+// Train runs the training of all modules together, see MultiLayerPerceptron.Train for the options.
+// WithVectorized requires every module to be a TensorModule, and WithWorkers every module to be registered with RegisterModule.
+func (s *Sequential) Train(cycles int, learnrate float64, trainX [][]float64, trainY [][]float64, opts ...TrainOption) (*TrainingHistory, error) {
+	return train(&trainee{Module: s, label: s.Label}, cycles, learnrate, trainX, trainY, opts...)
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"nn/network/exptree"
+	"testing"
+)
+
+// newSequential mixes a layer, a layer normalization, a dropout and a neuron, all seeded
+func newSequential() *Sequential {
+	rng := rand.New(NewSource(4))
+	return NewSequential("seq",
+		NewLayer("hidden", 3, 4, WithRand(rng)),
+		NewLayerNorm("norm", 4),
+		NewDropout("dropout", 0.5, rand.New(NewSource(5))),
+		NewNeuron("out", 4, WithRand(rng), WithActivation(ActivationSigmoid)).AsModule(),
+	)
+}
+
+func TestSequentialChainsModules(t *testing.T) {
+	s := newSequential()
+	in := []float64{0.2, -0.7, 1.5}
+
+	hidden, norm, out := s.Modules[0].(*Layer), s.Modules[1].(*LayerNorm), s.Modules[3].(*NeuronModule)
+	// in inference mode, the dropout lets its inputs through
+	want := []float64{out.Neuron.Predict(norm.Predict(hidden.Predict(in)))}
+	nodes := []*exptree.Node{}
+	for i, x := range in {
+		nodes = append(nodes, exptree.NewConstant(fmt.Sprintf("in%d", i), x))
+	}
+	for _, got := range [][]float64{nodesData(s.Forwards(nodes)), s.Predict(in)} {
+		if len(got) != 1 || math.Abs(got[0]-want[0]) > 1e-12 {
+			t.Fatalf("computes %v, want %v", got, want)
+		}
+	}
+
+	if got, want := len(s.Parameters()), len(hidden.Parameters())+len(norm.Parameters())+len(out.Parameters()); got != want {
+		t.Fatalf("has %d parameters, want %d", got, want)
+	}
+	if s.InputSize() != 3 || s.OutputSize() != 1 {
+		t.Fatalf("takes %d inputs to %d outputs, want 3 to 1", s.InputSize(), s.OutputSize())
+	}
+}
+
+func TestSequentialSharedModule(t *testing.T) {
+	// a module appearing twice is trained as one, its parameters listed once
+	layer := NewLayer("shared", 2, 2)
+	s := NewSequential("seq", layer, layer)
+	if got := len(s.Parameters()); got != len(layer.Parameters()) {
+		t.Fatalf("has %d parameters, want %d", got, len(layer.Parameters()))
+	}
+}
+
+func TestSequentialMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("chaining a layer of 4 outputs to one of 3 inputs did not panic")
+		}
+	}()
+	// the dropout keeps the size of its inputs and is skipped
+	NewSequential("seq", NewLayer("a", 2, 4), NewDropout("dropout", 0.5, nil), NewLayer("b", 3, 1))
+}
+
+func TestSequentialTraining(t *testing.T) {
+	s := newSequential()
+	dropout := s.Modules[2].(*Dropout)
+	s.SetTraining(true)
+	if !s.Training() || !dropout.Training {
+		t.Fatal("training mode not passed to the dropout")
+	}
+	s.SetTraining(false)
+	if s.Training() || dropout.Training {
+		t.Fatal("inference mode not passed to the dropout")
+	}
+
+	x := [][]float64{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}, {1, 1, 1}}
+	y := [][]float64{{0}, {1}, {1}, {0}}
+	history, err := s.Train(40, 0.5, x, y, WithBatchSize(4), WithShuffle(rand.New(NewSource(6))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	losses := history.Losses()
+	if losses[len(losses)-1] >= losses[0] {
+		t.Fatalf("loss went from %g to %g", losses[0], losses[len(losses)-1])
+	}
+	if s.Training() || dropout.Training {
+		t.Fatal("left in training mode after Train")
+	}
+}
+
+func TestSequentialSaveLoad(t *testing.T) {
+	s := newSequential()
+	buf := bytes.Buffer{}
+	if err := WriteModuleJSON(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadModuleJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := m.(*Sequential)
+	if !ok {
+		t.Fatalf("loaded a %T, want a *Sequential", m)
+	}
+	if _, ok := loaded.Modules[3].(*NeuronModule); !ok {
+		t.Fatalf("loaded the neuron as a %T, want a *NeuronModule", loaded.Modules[3])
+	}
+	in := []float64{0.2, -0.7, 1.5}
+	if got, want := loaded.Predict(in), s.Predict(in); !equalFloats(got, want) {
+		t.Fatalf("loaded sequential predicts %v, want %v", got, want)
+	}
+}
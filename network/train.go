@@ -0,0 +1,294 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// TrainOption configures a call to MultiLayerPerceptron.Train or Sequential.Train
+type TrainOption func(c *trainConfig)
+
+type trainConfig struct {
+	optimizer      Optimizer
+	loss           Loss
+	scheduler      Scheduler
+	learnRateHooks []func(epoch int, learnrate float64)
+	batchSize      int
+	shuffle        *rand.Rand
+	dropLast       bool
+	callbacks      []Callback
+	validX         [][]float64
+	validY         [][]float64
+	validSplit     float64
+	earlyStopping  *EarlyStopping
+	initialEpoch   int
+	initialLoss    float64
+	vectorized     bool
+	workers        int
+	replicas       []*trainee
+	clippers       []GradientClipper
+	regularization *Regularization
+}
+
+// WithOptimizer sets the optimizer used to update the parameters, plain gradient descent by default.
+// The optimizer keeps its own learning rate, e.g. the one passed to NewAdam or restored from a checkpoint, unless a
+// scheduler is set.
+func WithOptimizer(optimizer Optimizer) TrainOption {
+	return func(c *trainConfig) { c.optimizer = optimizer }
+}
+
+// WithLoss sets the loss minimized by the training, MeanSquaredError by default
+func WithLoss(loss Loss) TrainOption {
+	return func(c *trainConfig) { c.loss = loss }
+}
+
+// WithBatchSize splits the training set into batches of `size` rows, running an optimizer step per batch.
+// A size of 1 is stochastic gradient descent. By default the whole training set is a single batch.
+func WithBatchSize(size int) TrainOption {
+	return func(c *trainConfig) { c.batchSize = size }
+}
+
+// WithShuffle shuffles the order of the rows at the start of each cycle using `rng`.
+// Pass a seeded source, e.g. rand.New(rand.NewSource(1)), for reproducible runs.
+func WithShuffle(rng *rand.Rand) TrainOption {
+	return func(c *trainConfig) { c.shuffle = rng }
+}
+
+// WithDropLast drops the last batch of each cycle when it is smaller than the batch size
+func WithDropLast() TrainOption {
+	return func(c *trainConfig) { c.dropLast = true }
+}
+
+// WithCallbacks registers callbacks notified as the training progresses
+func WithCallbacks(callbacks ...Callback) TrainOption {
+	return func(c *trainConfig) { c.callbacks = append(c.callbacks, callbacks...) }
+}
+
+// WithValidation sets the validation set, evaluated after each epoch without computing gradients
+func WithValidation(validX [][]float64, validY [][]float64) TrainOption {
+	return func(c *trainConfig) { c.validX, c.validY = validX, validY }
+}
+
+// WithValidationSplit holds out the last `fraction` of the rows of the training set as the validation set
+func WithValidationSplit(fraction float64) TrainOption {
+	return func(c *trainConfig) { c.validSplit = fraction }
+}
+
+// WithEarlyStopping ends the training once the monitored loss has not improved by more than `minDelta` for `patience` epochs.
+// The validation loss is monitored if there is a validation set, the training loss otherwise.
+// With `restoreBest` the parameters are set back to those of the best epoch once the training ends.
+func WithEarlyStopping(patience int, minDelta float64, restoreBest bool) TrainOption {
+	return WithEarlyStopper(NewEarlyStopping(patience, minDelta, restoreBest))
+}
+
+// WithEarlyStopper is WithEarlyStopping with an early stopping built by NewEarlyStopping, e.g. to save it in a Checkpoint
+func WithEarlyStopper(earlyStopping *EarlyStopping) TrainOption {
+	return func(c *trainConfig) { c.earlyStopping = earlyStopping }
+}
+
+// WithInitialEpoch starts the training at `epoch` instead of 0, e.g. to resume from a checkpoint.
+// Train then runs the epochs from `epoch` up to `cycles`.
+func WithInitialEpoch(epoch int) TrainOption {
+	return func(c *trainConfig) { c.initialEpoch = epoch }
+}
+
+// WithResume continues the training saved in `checkpoint`, once read with LoadCheckpoint: it starts at its epoch, feeds
+// its loss to the scheduler, and uses its optimizer, scheduler and early stopping when they are set.
+// Options after it take precedence.
+func WithResume(checkpoint *Checkpoint) TrainOption {
+	return func(c *trainConfig) {
+		c.initialEpoch, c.initialLoss = checkpoint.Epoch, checkpoint.Loss
+		if checkpoint.Optimizer != nil {
+			c.optimizer = checkpoint.Optimizer
+		}
+		if checkpoint.Scheduler != nil {
+			c.scheduler = checkpoint.Scheduler
+		}
+		if checkpoint.EarlyStopping != nil {
+			c.earlyStopping = checkpoint.EarlyStopping
+		}
+	}
+}
+
+// WithVectorized computes each batch with tensors, a matmul per layer, instead of a node per scalar.
+// The loss must implement TensorLoss and each layer must share an activation registered with RegisterElementwiseActivation.
+func WithVectorized() TrainOption {
+	return func(c *trainConfig) { c.vectorized = true }
+}
+
+// WithWorkers splits each batch into `workers` contiguous shards whose gradients are computed concurrently.
+// The gradients are added up in shard order, so training stays deterministic for a given number of workers.
+// Batch normalization normalizes each shard with its own statistics, so it trains differently than with a single worker.
+func WithWorkers(workers int) TrainOption {
+	return func(c *trainConfig) { c.workers = workers }
+}
+
+// WithGradientClipping limits the gradients with `clippers`, in order, after they are computed and before the optimizer step.
+// The gradient norm reported to callbacks and in the history is the one before clipping.
+func WithGradientClipping(clippers ...GradientClipper) TrainOption {
+	return func(c *trainConfig) { c.clippers = append(c.clippers, clippers...) }
+}
+
+// WithRegularization adds the penalty of `regularization` over the parameters to the loss of each batch.
+// With WithWorkers the penalty is computed once per batch, on the parameters of the trained network rather than its copies.
+func WithRegularization(regularization Regularization) TrainOption {
+	return func(c *trainConfig) { c.regularization = &regularization }
+}
+
+// WithScheduler sets the scheduler consulted at the start of each cycle for the learning rate, starting from the
+// learning rate passed to Train. Without one, the learning rate of the optimizer is used for all cycles.
+func WithScheduler(scheduler Scheduler) TrainOption {
+	return func(c *trainConfig) { c.scheduler = scheduler }
+}
+
+// WithLearningRateHook registers `hook` to be called at the start of each cycle with the learning rate in use
+func WithLearningRateHook(hook func(epoch int, learnrate float64)) TrainOption {
+	return func(c *trainConfig) { c.learnRateHooks = append(c.learnRateHooks, hook) }
+}
+
+func newTrainConfig(learnrate float64, opts ...TrainOption) *trainConfig {
+	c := &trainConfig{initialLoss: math.NaN()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.optimizer == nil {
+		c.optimizer = NewSGD(learnrate)
+	}
+	if c.loss == nil {
+		c.loss = MeanSquaredError{}
+	}
+	return c
+}
+
+// scheduleLearningRate sets the learning rate of the optimizer for `epoch` and reports it to the hooks
+func (c *trainConfig) scheduleLearningRate(epoch int, initial float64, loss float64) {
+	if c.scheduler != nil {
+		c.optimizer.SetLearningRate(c.scheduler.LearningRate(epoch, initial, loss))
+	}
+	for _, hook := range c.learnRateHooks {
+		hook(epoch, c.optimizer.LearningRate())
+	}
+}
+
+// validationSet splits the validation set off the training set if needed, returning both
+func (c *trainConfig) validationSet(trainX, trainY [][]float64) ([][]float64, [][]float64, [][]float64, [][]float64, error) {
+	if c.validSplit == 0 {
+		return trainX, trainY, c.validX, c.validY, nil
+	} else if len(c.validX) > 0 {
+		return nil, nil, nil, nil, fmt.Errorf("train: validation set and validation split are mutually exclusive")
+	}
+
+	held := int(math.Round(c.validSplit * float64(len(trainX))))
+	if c.validSplit < 0 || held < 1 || held >= len(trainX) {
+		return nil, nil, nil, nil, fmt.Errorf("train: validation split %g leaves no rows for training or validation out of %d", c.validSplit, len(trainX))
+	}
+	cut := len(trainX) - held
+	return trainX[:cut], trainY[:cut], trainX[cut:], trainY[cut:], nil
+}
+
+// checkBatches validates that a cycle over `rows` rows has at least a batch
+func (c *trainConfig) checkBatches(rows int) error {
+	if c.dropLast && c.batchSize > rows {
+		return fmt.Errorf("train: batch size %d with drop last leaves no batch out of %d rows", c.batchSize, rows)
+	}
+	return nil
+}
+
+// batches returns the row indices of each batch of a cycle over `rows` rows
+func (c *trainConfig) batches(rows int) [][]int {
+	order := make([]int, rows)
+	for i := range order {
+		order[i] = i
+	}
+	if c.shuffle != nil {
+		c.shuffle.Shuffle(rows, func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	size := c.batchSize
+	if size <= 0 || (size > rows && !c.dropLast) {
+		size = rows
+	}
+
+	batches := [][]int{}
+	for start := 0; start < rows; start += size {
+		end := start + size
+		if end > rows {
+			if c.dropLast {
+				break
+			}
+			end = rows
+		}
+		batches = append(batches, order[start:end])
+	}
+	return batches
+}
+
+func (c *trainConfig) onEpochStart(state *TrainingState) {
+	for _, callback := range c.callbacks {
+		callback.OnEpochStart(state)
+	}
+}
+
+func (c *trainConfig) onBatchEnd(state *TrainingState) {
+	for _, callback := range c.callbacks {
+		callback.OnBatchEnd(state)
+	}
+}
+
+func (c *trainConfig) onEpochEnd(state *TrainingState) {
+	for _, callback := range c.callbacks {
+		callback.OnEpochEnd(state)
+	}
+}
+
+// EarlyStopping tracks the monitored loss across epochs, keeping the parameters of the best one, see WithEarlyStopping
+type EarlyStopping struct {
+	patience    int
+	minDelta    float64
+	restoreBest bool
+
+	best      float64
+	bestEpoch int
+	wait      int
+	snapshot  map[string]float64
+}
+
+// NewEarlyStopping creates an early stopping, see WithEarlyStopping
+func NewEarlyStopping(patience int, minDelta float64, restoreBest bool) *EarlyStopping {
+	return &EarlyStopping{patience: patience, minDelta: minDelta, restoreBest: restoreBest, best: math.Inf(1), bestEpoch: -1}
+}
+
+// update records the loss of the epoch in `state`, returning whether the training should stop
+func (e *EarlyStopping) update(state *TrainingState, params []*Parameter) bool {
+	loss := state.ValidationLoss
+	if math.IsNaN(loss) {
+		loss = state.Loss
+	}
+
+	if loss < e.best-e.minDelta {
+		e.best, e.bestEpoch, e.wait = loss, state.Epoch, 0
+		if e.restoreBest {
+			e.snapshot = map[string]float64{}
+			for _, p := range params {
+				e.snapshot[p.Name] = p.Data
+			}
+		}
+		return false
+	}
+
+	e.wait++
+	return e.wait >= e.patience
+}
+
+// restore sets the parameters back to the best epoch, if asked to
+func (e *EarlyStopping) restore(params []*Parameter) {
+	if !e.restoreBest {
+		return
+	}
+	for _, p := range params {
+		if data, ok := e.snapshot[p.Name]; ok {
+			p.Data = data
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"nn/network/exptree"
+	"time"
+)
+
+// trainee is a module being trained, along with the label its loss is built under
+type trainee struct {
+	Module
+	label string
+}
+
+// train runs the training loop of `t`, see MultiLayerPerceptron.Train
+func train(t *trainee, cycles int, learnrate float64, trainX [][]float64, trainY [][]float64, opts ...TrainOption) (*TrainingHistory, error) {
+	if err := t.checkDataset("train", trainX, trainY); err != nil {
+		return nil, err
+	}
+
+	config := newTrainConfig(learnrate, opts...)
+	trainX, trainY, validX, validY, err := config.validationSet(trainX, trainY)
+	if err != nil {
+		return nil, err
+	} else if err := t.checkDataset("train: validation", validX, validY); len(validX) > 0 && err != nil {
+		return nil, err
+	} else if err := config.checkBatches(len(trainX)); err != nil {
+		return nil, err
+	} else if err := t.checkVectorized(config); err != nil {
+		return nil, err
+	} else if config.replicas, err = t.replicate(config.workers); err != nil {
+		return nil, err
+	}
+
+	defer saveTraining(t.Module)()
+	setTraining(t.Module, true)
+
+	var (
+		trainx, trainy = toNodes(trainX, trainY)
+		validx, validy = toNodes(validX, validY)
+		history        = &TrainingHistory{BestEpoch: -1}
+		state          = &TrainingState{Loss: config.initialLoss}
+		start          = time.Now()
+	)
+
+	for i := config.initialEpoch; i < cycles && !state.Stop; i++ {
+		epochStart := time.Now()
+		config.scheduleLearningRate(i, learnrate, state.Loss)
+		batches := config.batches(len(trainx))
+		*state = TrainingState{Epoch: i, Batches: len(batches), LearningRate: config.optimizer.LearningRate(), ValidationLoss: math.NaN()}
+		config.onEpochStart(state)
+		if state.Stop {
+			break
+		}
+
+		epochLoss, normSum, seen, partial := 0.0, 0.0, 0, false
+		for b, batch := range batches {
+			batchx, batchy := [][]*exptree.Node{}, [][]*exptree.Node{}
+			for _, row := range batch {
+				batchx, batchy = append(batchx, trainx[row]), append(batchy, trainy[row])
+			}
+
+			state.Batch = b
+			state.BatchLoss, state.GradientNorm = t.trainBatch(config, batchx, batchy)
+			normSum += state.GradientNorm
+			seen += len(batch)
+			if config.loss.Reduction() == ReduceSum {
+				epochLoss += state.BatchLoss
+			} else {
+				epochLoss += state.BatchLoss * float64(len(batch))
+			}
+
+			config.onBatchEnd(state)
+			if state.Stop {
+				partial = b+1 < len(batches)
+				break
+			}
+		}
+		if config.loss.Reduction() != ReduceSum {
+			epochLoss /= float64(seen)
+		}
+
+		state.Loss = epochLoss
+		if len(validx) > 0 {
+			state.ValidationLoss = t.evaluate(config, validx, validy)
+		}
+		if config.earlyStopping != nil && !partial && config.earlyStopping.update(state, t.Parameters()) {
+			history.EarlyStopped, state.Stop = true, true
+		}
+
+		config.onEpochEnd(state)
+		history.Epochs = append(history.Epochs, EpochRecord{
+			Epoch:          i,
+			Loss:           epochLoss,
+			ValidationLoss: state.ValidationLoss,
+			LearningRate:   state.LearningRate,
+			GradientNorm:   normSum / float64(state.Batch+1),
+			Duration:       time.Since(epochStart),
+			Partial:        partial,
+		})
+	}
+
+	if config.earlyStopping != nil {
+		history.BestEpoch = config.earlyStopping.bestEpoch
+		config.earlyStopping.restore(t.Parameters())
+	}
+	history.Stopped = state.Stop
+	history.Duration = time.Since(start)
+	return history, nil
+}
+
+// checkDataset validates that `x` and `y` are non empty, of the same length and, for a Sized module, match its dimensions
+func (t *trainee) checkDataset(prefix string, x [][]float64, y [][]float64) error {
+	if len(x) <= 0 {
+		return fmt.Errorf("%s: inputs must contain something", prefix)
+	} else if len(y) != len(x) {
+		return fmt.Errorf("%s: mismatch b/w input and output, want %d got %d", prefix, len(x), len(y))
+	}
+	sized, ok := t.Module.(Sized)
+	if !ok {
+		return nil
+	} else if in := sized.InputSize(); in >= 0 && len(x[0]) != in {
+		return fmt.Errorf("%s: mismatch b/w train set dimensions & %s dimensions, want %d got %d", prefix, t.label, in, len(x[0]))
+	} else if out := sized.OutputSize(); out >= 0 && len(y[0]) != out {
+		return fmt.Errorf("%s: mismatch b/w train set dimensions & %s dimensions, want %d got %d", prefix, t.label, out, len(y[0]))
+	}
+	return nil
+}
+
+// checkVectorized validates that the module and the loss can be computed with tensors, if asked to
+func (t *trainee) checkVectorized(config *trainConfig) error {
+	if !config.vectorized {
+		return nil
+	} else if _, ok := config.loss.(TensorLoss); !ok {
+		return fmt.Errorf("train: vectorized: loss %T cannot be computed with tensors", config.loss)
+	} else if err := checkTensor(t.Module); err != nil {
+		return fmt.Errorf("train: vectorized: %s", err)
+	}
+	return nil
+}
+
+// trainBatch runs a single optimizer step over a batch, returning the loss and the global gradient norm before clipping
+func (t *trainee) trainBatch(config *trainConfig, batchx, batchy [][]*exptree.Node) (loss float64, gradientNorm float64) {
+	if len(config.replicas) > 1 && len(batchx) > 1 {
+		loss = t.parallelGradients(config, batchx, batchy)
+	} else {
+		loss = t.gradients(config, batchx, batchy)
+	}
+	if penalty := t.penalty(config); penalty != nil {
+		exptree.BackPropagate(penalty)
+		loss += penalty.Data
+	}
+
+	params := t.Parameters()
+	gradientNorm = GradientNorm(params)
+	for _, clipper := range config.clippers {
+		clipper.Clip(params)
+	}
+	config.optimizer.Step(params)
+	UpdateRunningAverages(t.Module)
+	return loss, gradientNorm
+}
+
+// gradients sets the gradients of the parameters to those of the loss over a batch, returning the loss
+func (t *trainee) gradients(config *trainConfig, batchx, batchy [][]*exptree.Node) float64 {
+	t.ZeroGradient()
+	if config.vectorized {
+		netloss := t.lossTensor(config.loss.(TensorLoss), nodesToTensor("batch_x", batchx), nodesToTensor("batch_y", batchy))
+		exptree.BackPropagateTensor(netloss)
+		return netloss.Data[0]
+	}
+	netloss := t.loss(config.loss, batchx, batchy)
+	exptree.BackPropagate(netloss)
+	return netloss.Data
+}
+
+// penalty builds the regularization term over the parameters of the module, nil without WithRegularization.
+// It is backpropagated on its own, its gradients adding up with those of the loss.
+func (t *trainee) penalty(config *trainConfig) *exptree.Node {
+	if config.regularization == nil {
+		return nil
+	}
+	return config.regularization.Node("penalty_"+t.label, t.Parameters())
+}
+
+// evaluate computes the loss over `x` and `y`, along with the penalty, without computing gradients
+func (t *trainee) evaluate(config *trainConfig, x, y [][]*exptree.Node) (loss float64) {
+	defer saveTraining(t.Module)()
+	setTraining(t.Module, false)
+
+	if config.vectorized {
+		loss = t.lossTensor(config.loss.(TensorLoss), nodesToTensor("eval_x", x), nodesToTensor("eval_y", y)).Data[0]
+	} else {
+		loss = t.loss(config.loss, x, y).Data
+	}
+	if penalty := t.penalty(config); penalty != nil {
+		loss += penalty.Data
+	}
+	return loss
+}
+
+// loss builds the loss of the predictions of the module for each row in x against the same row in y
+func (t *trainee) loss(loss Loss, x, y [][]*exptree.Node) *exptree.Node {
+	return BatchLoss("loss_"+t.label, loss, forwardsBatch(t.Module, x), y)
+}
+
+// lossTensor builds the loss of the predictions of the module for the batch `x` against `y`, both 2D tensors
+func (t *trainee) lossTensor(loss TensorLoss, x, y *exptree.Tensor) *exptree.Tensor {
+	return loss.Tensor("loss_"+t.label, forwardsTensor(t.Module, x), y)
+}